@@ -0,0 +1,136 @@
+package main
+
+import (
+	"clase19/internal/category"
+	"clase19/internal/product"
+	"clase19/pkg/migrate"
+	"clase19/pkg/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runCommand ejecuta un subcomando del binario en lugar de levantar el servidor
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "purge":
+		return runPurge(args[1:])
+	case "rebuild":
+		return runRebuild(args[1:])
+	case "copy":
+		return runCopy(args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// runMigrate ejecuta migrate up|down|status sobre la base de DB_URL
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+	db, dialect, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := migrate.New(db, dialect.Name)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", count)
+	case "down":
+		migration, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		list, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range list {
+			if status.Applied {
+				fmt.Printf("%04d_%s\tapplied %s\n", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", status.Version, status.Name)
+			}
+		}
+	default:
+		return errors.New("usage: migrate up|down|status")
+	}
+	return nil
+}
+
+// runExport vuelca todos los productos del store configurado con el formato de products.json
+func runExport(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: export <file>")
+	}
+	storage, _, _, err := newStorage()
+	if err != nil {
+		return err
+	}
+	products, err := storage.GetAll(context.Background())
+	if err != nil {
+		return err
+	}
+	bytes, err := json.Marshal(products)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(args[0], bytes, 0644)
+}
+
+// runPurge elimina definitivamente los productos borrados hace mas del periodo de retencion indicado (ej. 720h)
+func runPurge(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: purge <retention>")
+	}
+	retention, err := time.ParseDuration(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid retention %q", args[0])
+	}
+	// el store memory se pierde al terminar el comando, purgarlo no tendria efecto
+	if os.Getenv("STORE") == "memory" {
+		return errors.New("purge needs a persistent store, STORE=memory is not supported")
+	}
+	storage, history, categories, err := newStorage()
+	if err != nil {
+		return err
+	}
+	categoryService := category.NewService(category.NewRepository(categories, storage))
+	service := product.NewService(product.NewRepository(storage, history), categoryService)
+	count, err := service.Purge(context.Background(), retention)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d products\n", count)
+	return nil
+}
+
+// runRebuild reconstruye la proyeccion del store events reproduciendo todo el log de eventos
+func runRebuild(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: rebuild")
+	}
+	count, err := store.RebuildProjection(eventsPath())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d events\n", count)
+	return nil
+}
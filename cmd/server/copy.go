@@ -0,0 +1,208 @@
+package main
+
+import (
+	"clase19/internal/domain"
+	"clase19/pkg/migrate"
+	"clase19/pkg/store"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// copyChunk es la cantidad de productos que se guardan en cada transaccion del destino
+const copyChunk = 500
+
+// copyUsage explica los formatos de origen y destino del comando copy
+const copyUsage = `usage: copy <from> <to>
+  each side is json:<path>, journal:<path>, events:<log path>, bolt:<path> or a DB_URL (mysql://, postgres://, sqlite://)
+  the destination must be empty. Ids are preserved; versions restart at 1 and deleted products are copied as
+  deleted at the time of the copy. Categories and history are not copied`
+
+// copyTarget es un store abierto por el comando copy
+type copyTarget struct {
+	store store.Store
+	// sql es la base del store, para ajustar su secuencia de ids al terminar; nil si no es sql
+	sql     *sql.DB
+	dialect store.Dialect
+	close   func()
+}
+
+// runCopy copia todos los productos, borrados incluidos, de un store a otro conservando los ids,
+// informa el avance y al terminar compara la cantidad y un checksum de ambos lados
+func runCopy(args []string) error {
+	if len(args) != 2 {
+		return errors.New(copyUsage)
+	}
+	ctx := context.Background()
+	ids := &copiedIDs{}
+	from, err := openCopyTarget(args[0], nil, false)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", args[0], err)
+	}
+	defer from.close()
+	to, err := openCopyTarget(args[1], ids, true)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", args[1], err)
+	}
+	defer to.close()
+
+	existing, err := to.store.Find(ctx, store.Query{Limit: 1, IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return errors.New("the destination already has products, copy needs an empty one")
+	}
+	products, err := from.store.Find(ctx, store.Query{IncludeDeleted: true}.OrderBy("id", false))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for start := 0; start < len(products); start += copyChunk {
+		end := start + copyChunk
+		if end > len(products) {
+			end = len(products)
+		}
+		err = to.store.WithTx(ctx, func(tx store.Store) error {
+			for _, p := range products[start:end] {
+				ids.next = p.Id
+				added, err := tx.AddOne(ctx, p)
+				if errors.Is(err, store.ErrDuplicateCode) {
+					failed++
+					fmt.Printf("product %s not copied: %v\n", p.Id, err)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("product %s: %w", p.Id, err)
+				}
+				if p.DeletedAt != nil {
+					if err = tx.DeleteOne(ctx, added.Id); err != nil {
+						return fmt.Errorf("product %s: %w", p.Id, err)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("copying products %d to %d: %w", start+1, end, err)
+		}
+		fmt.Printf("copied %d/%d products\n", end, len(products))
+	}
+	if to.sql != nil {
+		if err = store.SyncIDSequence(ctx, to.sql, to.dialect); err != nil {
+			return err
+		}
+	}
+
+	copied, err := to.store.Find(ctx, store.Query{IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	sourceSum, targetSum := productsChecksum(products), productsChecksum(copied)
+	fmt.Printf("source:      %d products, checksum %s\n", len(products), sourceSum)
+	fmt.Printf("destination: %d products, checksum %s\n", len(copied), targetSum)
+	if failed > 0 || len(copied) != len(products) || sourceSum != targetSum {
+		return errors.New("verification failed, the destination doesn't match the source")
+	}
+	fmt.Println("verified")
+	return nil
+}
+
+// openCopyTarget abre el store indicado en spec. El destino usa ids como generador y, si es sql, se migra
+func openCopyTarget(spec string, ids store.IDGenerator, destination bool) (copyTarget, error) {
+	kind, path := "", spec
+	if i := strings.Index(spec, ":"); i > 0 {
+		kind, path = spec[:i], spec[i+1:]
+	}
+	noop := func() {}
+	switch kind {
+	case "json":
+		if destination {
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				if err = os.WriteFile(path, []byte("[]"), 0644); err != nil {
+					return copyTarget{}, err
+				}
+			}
+		} else if _, err := os.Stat(path); err != nil {
+			return copyTarget{}, err
+		}
+		return copyTarget{store: store.NewJsonStore(path, ids), close: noop}, nil
+	case "journal":
+		s, err := store.NewJournalStore(path, 0, ids)
+		return copyTarget{store: s, close: noop}, err
+	case "events":
+		s, err := store.NewEventStore(path, "", 0, ids)
+		return copyTarget{store: s, close: noop}, err
+	case "bolt":
+		s, err := store.NewBoltStore(path, "", ids)
+		if err != nil {
+			return copyTarget{}, err
+		}
+		return copyTarget{store: s, close: func() { s.(io.Closer).Close() }}, nil
+	}
+	dialect, dsn, err := store.ParseDSN(spec)
+	if err != nil {
+		return copyTarget{}, err
+	}
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		return copyTarget{}, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return copyTarget{}, err
+	}
+	target := copyTarget{sql: db, dialect: dialect, close: func() { db.Close() }}
+	if dialect == store.SQLite {
+		target.store, err = store.NewSqliteStore(db, ids)
+	} else {
+		var migrator *migrate.Migrator
+		if migrator, err = migrate.New(db, dialect.Name); err == nil {
+			_, err = migrator.Up()
+		}
+		target.store = store.NewSqlStore(db, dialect, ids)
+	}
+	if err != nil {
+		db.Close()
+		return copyTarget{}, err
+	}
+	return target, nil
+}
+
+// copiedIDs entrega como id nuevo el id de origen del producto que se esta copiando
+type copiedIDs struct {
+	next domain.ID
+}
+
+// NewID devuelve el id de origen del producto en curso; cada id se entrega una sola vez
+func (g *copiedIDs) NewID(ctx context.Context) (domain.ID, error) {
+	if g.next == "" {
+		return "", errors.New("no source id to assign")
+	}
+	id := g.next
+	g.next = ""
+	return id, nil
+}
+
+// productsChecksum resume los datos que copy conserva de cada producto, ordenados por id
+func productsChecksum(products []domain.Product) string {
+	lines := make([]string, 0, len(products))
+	for _, p := range products {
+		lines = append(lines, strings.Join([]string{
+			string(p.Id), p.Name, strconv.Itoa(p.Quantity), p.CodeValue, strconv.FormatBool(p.IsPublished),
+			p.Expiration.String(), p.Price.String(), string(p.CategoryId), string(p.ParentId), p.Variant, strconv.FormatBool(p.DeletedAt != nil),
+		}, "\t"))
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
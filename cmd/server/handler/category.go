@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"clase19/internal/category"
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+	"clase19/pkg/web"
+
+	"github.com/gin-gonic/gin"
+)
+
+type categoryHandler struct {
+	s category.Service
+}
+
+// NewCategoryHandler crea un nuevo controller de categorias
+func NewCategoryHandler(s category.Service) *categoryHandler {
+	return &categoryHandler{
+		s: s,
+	}
+}
+
+// GetAll godoc
+// @Summary      Get all categories
+// @Description  Get all categories ordered by id. Each one has the id of its parent category, if any
+// @Tags         categories
+// @Produce      json
+// @Success      200 {object}  web.response
+// @Failure      500 {object}  web.errorResponse
+// @Router       /categories [get]
+func (h *categoryHandler) GetAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categories, err := h.s.GetAll(c.Request.Context())
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, categories)
+	}
+}
+
+// GetByID godoc
+// @Summary      Get a category by Id
+// @Description  Get a category by Id
+// @Tags         categories
+// @Produce      json
+// @Param        id   path      string  true  "Category Id"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Router       /categories/:id [get]
+func (h *categoryHandler) GetByID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		cat, err := h.s.GetByID(c.Request.Context(), id)
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			web.Failure(c, 404, err)
+			return
+		}
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, cat)
+	}
+}
+
+// Post godoc
+// @Summary      Create a new category
+// @Description  Create a root category, or a subcategory if parent_id is sent
+// @Tags         categories
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        body body domain.Category true "Category"
+// @Success      201 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Router       /categories [post]
+func (h *categoryHandler) Post() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cat, ok := bindCategory(c)
+		if !ok {
+			return
+		}
+		cat, err := h.s.Create(c.Request.Context(), cat)
+		if err != nil {
+			categoryFailure(c, err)
+			return
+		}
+		web.Success(c, 201, cat)
+	}
+}
+
+// Put godoc
+// @Summary      Update a category
+// @Description  Replace the name and the parent of a category. Without parent_id the category becomes a root category
+// @Tags         categories
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Category Id"
+// @Param        body body domain.Category true "Category"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Router       /categories/:id [put]
+func (h *categoryHandler) Put() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		cat, ok := bindCategory(c)
+		if !ok {
+			return
+		}
+		cat, err = h.s.Update(c.Request.Context(), id, cat)
+		if err != nil {
+			categoryFailure(c, err)
+			return
+		}
+		web.Success(c, 200, cat)
+	}
+}
+
+// Delete godoc
+// @Summary      Delete a category
+// @Description  Delete a category without subcategories nor products
+// @Tags         categories
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Category Id"
+// @Success      204 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
+// @Router       /categories/:id [delete]
+func (h *categoryHandler) Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		if err = h.s.Delete(c.Request.Context(), id); err != nil {
+			categoryFailure(c, err)
+			return
+		}
+		web.Success(c, 204, fmt.Sprintf("category %s deleted", id))
+	}
+}
+
+// bindCategory lee y valida la categoria del body; si no es valida ya escribe la respuesta
+func bindCategory(c *gin.Context) (domain.Category, bool) {
+	var cat domain.Category
+	if err := c.ShouldBindJSON(&cat); err != nil {
+		web.Failure(c, 400, errors.New("invalid json"))
+		return domain.Category{}, false
+	}
+	if cat.Name == "" {
+		web.Failure(c, 400, errors.New("name can't be empty"))
+		return domain.Category{}, false
+	}
+	if cat.ParentId != "" {
+		if _, err := domain.ParseID(string(cat.ParentId)); err != nil {
+			web.Failure(c, 400, errors.New("invalid parent_id"))
+			return domain.Category{}, false
+		}
+	}
+	return cat, true
+}
+
+// categoryFailure escribe la respuesta de un error del servicio de categorias con su status
+func categoryFailure(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrCategoryNotFound):
+		failure(c, 404, err)
+	case errors.Is(err, category.ErrParentNotFound), errors.Is(err, category.ErrCycle):
+		failure(c, 400, err)
+	case errors.Is(err, category.ErrHasChildren), errors.Is(err, category.ErrInUse):
+		failure(c, 409, err)
+	default:
+		failure(c, 500, err)
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"clase19/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	dateFormatsMu sync.RWMutex
+	// dateFormats son los formatos de entrada aceptados ademas de yyyy-mm-dd; por defecto dd/mm/yyyy
+	dateFormats = []string{domain.LegacyDateLayout}
+)
+
+// SetDateFormats configura los formatos de fecha aceptados en los requests ademas de yyyy-mm-dd, escritos con
+// dd, mm y yyyy (ej. dd/mm/yyyy o mm-dd-yyyy). Se prueban en orden, asi que ante fechas ambiguas gana el primero.
+// No cambian como se leen las fechas guardadas en los stores
+func SetDateFormats(patterns []string) error {
+	layouts := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if strings.Count(pattern, "dd") != 1 || strings.Count(pattern, "mm") != 1 || strings.Count(pattern, "yyyy") != 1 {
+			return fmt.Errorf("invalid date format %q, must have dd, mm and yyyy once", pattern)
+		}
+		layout := strings.NewReplacer("dd", "02", "mm", "01", "yyyy", "2006").Replace(pattern)
+		if layout != domain.DateLayout {
+			layouts = append(layouts, layout)
+		}
+	}
+	dateFormatsMu.Lock()
+	defer dateFormatsMu.Unlock()
+	dateFormats = layouts
+	return nil
+}
+
+// parseDate interpreta una fecha de un request con los formatos configurados; "" es la fecha vacia
+func parseDate(s string) (domain.Date, error) {
+	if s == "" {
+		return domain.Date{}, nil
+	}
+	dateFormatsMu.RLock()
+	layouts := dateFormats
+	dateFormatsMu.RUnlock()
+	return domain.ParseDateWith(s, layouts)
+}
+
+// inputDate es una fecha de un request, que se interpreta con los formatos configurados en lugar de los de
+// domain.Date, que son los de los stores
+type inputDate domain.Date
+
+// UnmarshalJSON acepta la fecha en los formatos configurados; "" y null son la fecha vacia
+func (d *inputDate) UnmarshalJSON(data []byte) error {
+	var s string
+	if string(data) != "null" {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%w, must be a string", domain.ErrInvalidDate)
+		}
+	}
+	date, err := parseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = inputDate(date)
+	return nil
+}
+
+// productInput es el body de un producto, con la fecha de vencimiento como inputDate
+type productInput struct {
+	domain.Product
+	Expiration inputDate `json:"expiration"`
+}
+
+// product devuelve el producto del body
+func (in productInput) product() domain.Product {
+	product := in.Product
+	product.Expiration = domain.Date(in.Expiration)
+	return product
+}
+
+// bindProduct lee el producto del body del request
+func bindProduct(c *gin.Context) (domain.Product, error) {
+	var in productInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		return domain.Product{}, err
+	}
+	return in.product(), nil
+}
+
+// decodeProduct lee un producto de un elemento de un request en lote
+func decodeProduct(data []byte) (domain.Product, error) {
+	var in productInput
+	if err := json.Unmarshal(data, &in); err != nil {
+		return domain.Product{}, err
+	}
+	return in.product(), nil
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSetDateFormats comprueba que se rechacen los formatos sin dd, mm y yyyy una sola vez cada uno
+func TestSetDateFormats(t *testing.T) {
+	t.Cleanup(func() { SetDateFormats([]string{"dd/mm/yyyy"}) })
+	for _, pattern := range []string{"dd/mm/yy", "mm/yyyy", "dd-dd-yyyy", "yyyy", "", "d/m/yyyy"} {
+		if err := SetDateFormats([]string{pattern}); err == nil {
+			t.Errorf("SetDateFormats(%q) accepted an invalid pattern", pattern)
+		}
+	}
+	for _, pattern := range []string{"mm/dd/yyyy", " dd.mm.yyyy ", "yyyy-mm-dd"} {
+		if err := SetDateFormats([]string{pattern}); err != nil {
+			t.Errorf("SetDateFormats(%q) returned %v", pattern, err)
+		}
+	}
+}
+
+// TestDateFormatsRequestOnly comprueba que DATE_FORMATS cambie como se leen las fechas de los requests, con el
+// primer formato ganando ante fechas ambiguas, y no como se leen los productos guardados
+func TestDateFormatsRequestOnly(t *testing.T) {
+	t.Cleanup(func() { SetDateFormats([]string{"dd/mm/yyyy"}) })
+	if err := SetDateFormats([]string{"mm/dd/yyyy", "dd/mm/yyyy"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		expiration string
+		want       domain.Date
+	}{
+		{"03/04/2030", domain.NewDate(2030, time.March, 4)},
+		{"31/12/2030", domain.NewDate(2030, time.December, 31)},
+		{"2030-03-04", domain.NewDate(2030, time.March, 4)},
+	}
+	for _, c := range cases {
+		product, err := bindRequest(t, `{"name": "p", "expiration": "`+c.expiration+`"}`)
+		if err != nil || product.Expiration != c.want {
+			t.Errorf("request with %s = %v, %v, want %v", c.expiration, product.Expiration, err, c.want)
+		}
+	}
+	if _, err := bindRequest(t, `{"name": "p", "expiration": "02/29/2023"}`); !errors.Is(err, domain.ErrInvalidDate) {
+		t.Errorf("request with 02/29/2023 returned %v, want ErrInvalidDate", err)
+	}
+
+	// un producto guardado se sigue leyendo con dd/mm/yyyy, y mm/dd/yyyy no le aplica
+	var stored domain.Product
+	if err := json.Unmarshal([]byte(`{"expiration": "03/04/2030"}`), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if want := domain.NewDate(2030, time.April, 3); stored.Expiration != want {
+		t.Errorf("stored 03/04/2030 read as %v, want %v", stored.Expiration, want)
+	}
+	if err := json.Unmarshal([]byte(`{"expiration": "12/31/2030"}`), &stored); !errors.Is(err, domain.ErrInvalidDate) {
+		t.Errorf("stored 12/31/2030 returned %v, want ErrInvalidDate", err)
+	}
+}
+
+// bindRequest lee el producto de un request con el body dado como lo hacen los handlers
+func bindRequest(t *testing.T, body string) (domain.Product, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return bindProduct(c)
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -8,6 +10,7 @@ import (
 
 	"clase19/internal/domain"
 	"clase19/internal/product"
+	"clase19/pkg/store"
 	"clase19/pkg/web"
 
 	"github.com/gin-gonic/gin"
@@ -30,11 +33,38 @@ func NewProductHandler(s product.Service) *productHandler {
 // @Tags         products
 // @Produce      json
 // @Param        token header string true "token"
+// @Param        include_deleted query bool false "Include deleted products"
+// @Param        category query string false "Only products of this category or any of its subcategories"
 // @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
 // @Router       /products [get]
 func (h *productHandler) GetAll() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		products, _ := h.s.GetAll()
+		deleted, err := includeDeleted(c)
+		if err != nil {
+			web.Failure(c, 400, err)
+			return
+		}
+		var products []domain.Product
+		if c.Query("category") != "" {
+			category, parseErr := domain.ParseID(c.Query("category"))
+			if parseErr != nil {
+				web.Failure(c, 400, errors.New("invalid category"))
+				return
+			}
+			products, err = h.s.GetByCategory(c.Request.Context(), category, deleted)
+			if errors.Is(err, store.ErrCategoryNotFound) {
+				web.Failure(c, 404, err)
+				return
+			}
+		} else {
+			products, err = h.s.GetAll(c.Request.Context(), deleted)
+		}
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
 		web.Success(c, 200, products)
 	}
 }
@@ -45,35 +75,49 @@ func (h *productHandler) GetAll() gin.HandlerFunc {
 // @Tags         products
 // @Produce      json
 // @Param        token header string true "token"
-// @Param        id   path      int  true  "Product Id"
+// @Param        id   path      string  true  "Product Id"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
 // @Router       /products/:id [get]
 func (h *productHandler) GetByID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idParam := c.Param("id")
-		id, err := strconv.Atoi(idParam)
+		id, err := domain.ParseID(c.Param("id"))
 		if err != nil {
 			web.Failure(c, 400, errors.New("invalid id"))
 			return
 		}
-		product, err := h.s.GetByID(id)
+		product, err := h.s.GetByID(c.Request.Context(), id)
 		if err != nil {
-			web.Failure(c, 404, errors.New("product not found"))
+			failure(c, 404, errors.New("product not found"))
 			return
 		}
-		web.Success(c, 200, product)
+		detail := productDetail{Product: product}
+		if product.ParentId == "" {
+			if detail.Variants, err = h.s.Variants(c.Request.Context(), id, false); err != nil {
+				failure(c, 500, err)
+				return
+			}
+		}
+		c.Header("ETag", strconv.Quote(strconv.Itoa(product.Version)))
+		web.Success(c, 200, detail)
 	}
 }
 
+// productDetail es la respuesta de GetByID: el producto y, si no es una variante, sus variantes
+type productDetail struct {
+	domain.Product
+	Variants []domain.Product `json:"variants,omitempty"`
+}
+
 // Search godoc
 // @Summary      Get  products by price
 // @Description  Get  products whose price is greater than a value from repository
 // @Tags         products
 // @Produce      json
 // @Param        token header string true "token"
-// @Param        priceGt   query      float64  true  "Price Gt"
+// @Param        priceGt   query      string  true  "Price Gt, with up to 2 decimals"
+// @Param        include_deleted query bool false "Include deleted products"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
@@ -81,14 +125,19 @@ func (h *productHandler) GetByID() gin.HandlerFunc {
 func (h *productHandler) Search() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		priceParam := c.Query("priceGt")
-		price, err := strconv.ParseFloat(priceParam, 64)
+		price, err := domain.ParseAmount(priceParam)
 		if err != nil {
 			web.Failure(c, 400, errors.New("invalid price"))
 			return
 		}
-		products, err := h.s.SearchPriceGt(price)
+		deleted, err := includeDeleted(c)
+		if err != nil {
+			web.Failure(c, 400, err)
+			return
+		}
+		products, err := h.s.SearchPriceGt(c.Request.Context(), price, deleted)
 		if err != nil {
-			web.Failure(c, 404, errors.New("product not found"))
+			failure(c, 404, errors.New("product not found"))
 			return
 		}
 		web.Success(c, 200, products)
@@ -101,7 +150,7 @@ func (h *productHandler) Search() gin.HandlerFunc {
 // @Tags         products
 // @Produce      json
 // @Param        token header string true "token"
-// @Param        list   query      []int  true  "List Ids"
+// @Param        list   query      []string  true  "List Ids"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
@@ -112,22 +161,22 @@ func (h *productHandler) ConsumerPrice() gin.HandlerFunc {
 			products    []domain.Product
 			total_price float64
 		}
-		ids := c.Query("list")
-		ids = strings.Replace(ids, "[", "", -1)
-		ids = strings.Replace(ids, "]", "", -1)
-		listIds := strings.Split(string(ids), ",")
-		var listIdsInt []int
+		list := c.Query("list")
+		list = strings.Replace(list, "[", "", -1)
+		list = strings.Replace(list, "]", "", -1)
+		listIds := strings.Split(string(list), ",")
+		var ids []domain.ID
 		for _, v := range listIds {
-			id, err := strconv.Atoi(v)
+			id, err := domain.ParseID(strings.TrimSpace(v))
 			if err != nil {
 				web.Failure(c, 400, errors.New("invalid id"))
 				return
 			}
-			listIdsInt = append(listIdsInt, id)
+			ids = append(ids, id)
 		}
-		products, price, err := h.s.ConsumerPrice(listIdsInt)
+		products, price, err := h.s.ConsumerPrice(c.Request.Context(), ids)
 		if err != nil {
-			web.Failure(c, 400, err)
+			failure(c, 400, err)
 			return
 		}
 		// data := response{products, price}
@@ -149,13 +198,13 @@ func (h *productHandler) ConsumerPrice() gin.HandlerFunc {
 // @Success      201 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
 // @Router       /products [post]
 func (h *productHandler) Post() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var product domain.Product
-		err := c.ShouldBindJSON(&product)
+		product, err := bindProduct(c)
 		if err != nil {
-			web.Failure(c, 400, errors.New("invalid json"))
+			web.Failure(c, 400, bindError(err))
 			return
 		}
 		valid, err := validateEmptys(&product)
@@ -163,14 +212,13 @@ func (h *productHandler) Post() gin.HandlerFunc {
 			web.Failure(c, 400, err)
 			return
 		}
-		valid, err = validateExpiration(&product)
-		if !valid {
-			web.Failure(c, 400, err)
+		p, err := h.s.Create(c.Request.Context(), product)
+		if errors.Is(err, store.ErrDuplicateCode) {
+			duplicateCode(c, err)
 			return
 		}
-		p, err := h.s.Create(product)
 		if err != nil {
-			web.Failure(c, 400, err)
+			failure(c, 400, err)
 			return
 		}
 		web.Success(c, 201, p)
@@ -184,21 +232,21 @@ func (h *productHandler) Post() gin.HandlerFunc {
 // @Produce      json
 // @Param        token header string true "token"
 // @Param        body body domain.Product true "Product"
-// @Param        id   path      int  true  "Product Id"
+// @Param        id   path      string  true  "Product Id"
+// @Param        If-Match header string false "Expected product version, same as the version field of the body"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
 // @Router       /products/:id [put]
 func (h *productHandler) Put() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idParam := c.Param("id")
-		id, err := strconv.Atoi(idParam)
+		id, err := domain.ParseID(c.Param("id"))
 		if err != nil {
 			web.Failure(c, 400, errors.New("invalid id"))
 			return
 		}
-		var product domain.Product
-		err = c.ShouldBindJSON(&product)
+		product, err := bindProduct(c)
 		if err != nil {
 			web.Failure(c, 400, err)
 			return
@@ -208,14 +256,21 @@ func (h *productHandler) Put() gin.HandlerFunc {
 			web.Failure(c, 400, err)
 			return
 		}
-		valid, err = validateExpiration(&product)
-		if !valid {
+		if err = expectedVersion(c, &product); err != nil {
 			web.Failure(c, 400, err)
 			return
 		}
-		p, err := h.s.UpdateProduct(id, product)
+		p, err := h.s.UpdateProduct(c.Request.Context(), id, product)
+		if errors.Is(err, store.ErrVersionConflict) {
+			failure(c, 409, err)
+			return
+		}
+		if errors.Is(err, store.ErrDuplicateCode) {
+			duplicateCode(c, err)
+			return
+		}
 		if err != nil {
-			web.Failure(c, 400, err)
+			failure(c, 400, err)
 			return
 		}
 		web.Success(c, 200, p)
@@ -229,34 +284,41 @@ func (h *productHandler) Put() gin.HandlerFunc {
 // @Produce      json
 // @Param        token header string true "token"
 // @Param        body body domain.Product true "Product"
-// @Param        id   path      int  true  "Product Id"
+// @Param        id   path      string  true  "Product Id"
+// @Param        If-Match header string false "Expected product version, same as the version field of the body"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
 // @Router       /products/:id [patch]
 func (h *productHandler) Patch() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idParam := c.Param("id")
-		id, err := strconv.Atoi(idParam)
+		id, err := domain.ParseID(c.Param("id"))
 		if err != nil {
 			web.Failure(c, 400, errors.New("invalid id"))
 			return
 		}
-		var product domain.Product
-		err = c.BindJSON(&product)
+		product, err := bindProduct(c)
 		if err != nil {
 			web.Failure(c, 400, err)
 			return
 		}
-		valid, err := validateExpiration(&product)
-		if !valid {
+		if err = expectedVersion(c, &product); err != nil {
 			web.Failure(c, 400, err)
 			return
 		}
-		p, err := h.s.UpdateProduct(id, product)
+		p, err := h.s.UpdateProduct(c.Request.Context(), id, product)
+		if errors.Is(err, store.ErrVersionConflict) {
+			failure(c, 409, err)
+			return
+		}
+		if errors.Is(err, store.ErrDuplicateCode) {
+			duplicateCode(c, err)
+			return
+		}
 		if err != nil {
 
-			web.Failure(c, 400, err)
+			failure(c, 400, err)
 			return
 		}
 		web.Success(c, 200, p)
@@ -270,67 +332,502 @@ func (h *productHandler) Patch() gin.HandlerFunc {
 // @Tags         products
 // @Produce      json
 // @Param        token header string true "token"
-// @Param        id   path      int  true  "Product Id"
+// @Param        id   path      string  true  "Product Id"
 // @Success      200 {object}  web.response
 // @Failure      400 {object}  web.errorResponse
 // @Failure      404 {object}  web.errorResponse
 // @Router       /products/:id [delete]
 func (h *productHandler) Delete() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		idParam := c.Param("id")
-		id, err := strconv.Atoi(idParam)
+		id, err := domain.ParseID(c.Param("id"))
 		if err != nil {
 			web.Failure(c, 400, errors.New("invalid id"))
 			return
 		}
-		err = h.s.Delete(id)
+		err = h.s.Delete(c.Request.Context(), id)
+		if errors.Is(err, product.ErrHasVariants) {
+			failure(c, 409, err)
+			return
+		}
+		if err != nil {
+			failure(c, 404, err)
+			return
+		}
+		web.Success(c, 204, fmt.Sprintf("user %s deleted", id))
+	}
+}
+
+// Restore godoc
+// @Summary      Restore a deleted product
+// @Description  Undo the delete of a product by id in repository
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Product Id"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
+// @Failure      500 {object}  web.errorResponse
+// @Router       /products/:id/restore [post]
+func (h *productHandler) Restore() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
 		if err != nil {
-			web.Failure(c, 404, err)
+			web.Failure(c, 400, errors.New("invalid id"))
 			return
 		}
-		web.Success(c, 204, fmt.Sprintf("user %d deleted", id))
+		p, err := h.s.Restore(c.Request.Context(), id)
+		switch {
+		case errors.Is(err, product.ErrParentNotFound):
+			failure(c, 409, errors.New("parent product is deleted, restore it first"))
+			return
+		case errors.Is(err, store.ErrNotFound):
+			failure(c, 404, errors.New("deleted product not found"))
+			return
+		case err != nil:
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, p)
+	}
+}
+
+// maxBulkItems es la cantidad maxima de elementos de un request en lote
+const maxBulkItems = 5000
+
+// bulkItem es el resultado de un elemento de un request en lote, con el status que tendria el request individual
+type bulkItem struct {
+	Index  int             `json:"index"`
+	Id     domain.ID       `json:"id,omitempty"`
+	Status int             `json:"status"`
+	Data   *domain.Product `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// ConflictingId es el producto que ya usa el codigo cuando Status es 409 por un codigo repetido
+	ConflictingId domain.ID `json:"conflicting_id,omitempty"`
+}
+
+// bulkResult es la respuesta de un request en lote
+type bulkResult struct {
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Items     []bulkItem `json:"items"`
+}
+
+// PostBulk godoc
+// @Summary      Create many products
+// @Description  Create many products in a single transaction, reporting the result of each one
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        body body []domain.Product true "Products"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      500 {object}  web.errorResponse
+// @Router       /products/bulk [post]
+func (h *productHandler) PostBulk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bindBulk(c)
+		if !ok {
+			return
+		}
+		products := make([]domain.Product, len(raw))
+		items := make([]bulkItem, len(raw))
+		var valid []domain.Product
+		var index []int
+		for i := range raw {
+			product, err := decodeProduct(raw[i])
+			if err != nil {
+				items[i] = bulkItem{Index: i, Status: 400, Error: bindError(err).Error()}
+				continue
+			}
+			products[i] = product
+			ok, err := validateEmptys(&products[i])
+			if !ok {
+				items[i] = bulkItem{Index: i, Status: 400, Error: err.Error()}
+				continue
+			}
+			valid = append(valid, products[i])
+			index = append(index, i)
+		}
+		results, err := h.s.CreateMany(c.Request.Context(), valid)
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, newBulkResult(items, index, results, 201))
+	}
+}
+
+// PatchBulk godoc
+// @Summary      Update many products
+// @Description  Update the fields sent of many products in a single transaction, reporting the result of each one. Every product needs its id, and its version to detect conflicting changes
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        body body []domain.Product true "Products"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      500 {object}  web.errorResponse
+// @Router       /products/bulk [patch]
+func (h *productHandler) PatchBulk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bindBulk(c)
+		if !ok {
+			return
+		}
+		products := make([]domain.Product, len(raw))
+		items := make([]bulkItem, len(raw))
+		var valid []domain.Product
+		var index []int
+		for i := range raw {
+			product, err := decodeProduct(raw[i])
+			if err != nil {
+				items[i] = bulkItem{Index: i, Status: 400, Error: bindError(err).Error()}
+				continue
+			}
+			products[i] = product
+			if _, err := domain.ParseID(string(products[i].Id)); err != nil {
+				items[i] = bulkItem{Index: i, Status: 400, Error: "invalid id"}
+				continue
+			}
+			valid = append(valid, products[i])
+			index = append(index, i)
+		}
+		results, err := h.s.UpdateMany(c.Request.Context(), valid)
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, newBulkResult(items, index, results, 200))
+	}
+}
+
+// DeleteBulk godoc
+// @Summary      Delete many products
+// @Description  Delete many products by id in a single transaction, reporting the result of each one
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        body body []string true "Product Ids"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      500 {object}  web.errorResponse
+// @Router       /products/bulk [delete]
+func (h *productHandler) DeleteBulk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ids []domain.ID
+		if err := c.ShouldBindJSON(&ids); err != nil {
+			web.Failure(c, 400, errors.New("invalid json"))
+			return
+		}
+		if err := validateBulkSize(len(ids)); err != nil {
+			web.Failure(c, 400, err)
+			return
+		}
+		items := make([]bulkItem, len(ids))
+		var valid []domain.ID
+		var index []int
+		for i, id := range ids {
+			if _, err := domain.ParseID(string(id)); err != nil {
+				items[i] = bulkItem{Index: i, Status: 400, Error: "invalid id"}
+				continue
+			}
+			valid = append(valid, id)
+			index = append(index, i)
+		}
+		results, err := h.s.DeleteMany(c.Request.Context(), valid)
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		result := newBulkResult(items, index, results, 204)
+		for i := range result.Items {
+			result.Items[i].Data = nil
+		}
+		web.Success(c, 200, result)
+	}
+}
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// historyPage es una pagina del historial de un producto
+type historyPage struct {
+	Entries []store.HistoryEntry `json:"entries"`
+	Total   int                  `json:"total"`
+	Limit   int                  `json:"limit"`
+	Offset  int                  `json:"offset"`
+}
+
+// History godoc
+// @Summary      Get the change history of a product
+// @Description  Get who changed each field of a product and when, newest first. Deleted products keep their history
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Product Id"
+// @Param        limit   query      int  false  "Page size, 20 by default and at most 100"
+// @Param        offset   query      int  false  "Entries to skip"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Failure      500 {object}  web.errorResponse
+// @Router       /products/:id/history [get]
+func (h *productHandler) History() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultHistoryLimit)))
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			web.Failure(c, 400, fmt.Errorf("invalid limit, must be between 1 and %d", maxHistoryLimit))
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			web.Failure(c, 400, errors.New("invalid offset"))
+			return
+		}
+		entries, total, err := h.s.History(c.Request.Context(), id, limit, offset)
+		if errors.Is(err, store.ErrNotFound) {
+			failure(c, 404, errors.New("product not found"))
+			return
+		}
+		if err != nil {
+			failure(c, 500, err)
+			return
+		}
+		web.Success(c, 200, historyPage{Entries: entries, Total: total, Limit: limit, Offset: offset})
+	}
+}
+
+// Variants godoc
+// @Summary      Get the variants of a product
+// @Description  Get the variants of a product, each with its own code_value, quantity, price and expiration
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Parent product Id"
+// @Param        include_deleted query bool false "Include deleted variants"
+// @Success      200 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Router       /products/:id/variants [get]
+func (h *productHandler) Variants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		deleted, err := includeDeleted(c)
+		if err != nil {
+			web.Failure(c, 400, err)
+			return
+		}
+		variants, err := h.s.Variants(c.Request.Context(), id, deleted)
+		if err != nil {
+			failure(c, 404, errors.New("product not found"))
+			return
+		}
+		web.Success(c, 200, variants)
+	}
+}
+
+// PostVariant godoc
+// @Summary      Create a variant of a product
+// @Description  Create a variant of a product. The variant takes name and category from the parent product (products have no description), and is updated and deleted like any other product
+// @Tags         products
+// @Produce      json
+// @Param        token header string true "token"
+// @Param        id   path      string  true  "Parent product Id"
+// @Param        body body domain.Product true "Variant"
+// @Success      201 {object}  web.response
+// @Failure      400 {object}  web.errorResponse
+// @Failure      404 {object}  web.errorResponse
+// @Failure      409 {object}  web.errorResponse
+// @Router       /products/:id/variants [post]
+func (h *productHandler) PostVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := domain.ParseID(c.Param("id"))
+		if err != nil {
+			web.Failure(c, 400, errors.New("invalid id"))
+			return
+		}
+		variant, err := bindProduct(c)
+		if err != nil {
+			web.Failure(c, 400, bindError(err))
+			return
+		}
+		variant.ParentId = id
+		valid, err := validateEmptys(&variant)
+		if !valid {
+			web.Failure(c, 400, err)
+			return
+		}
+		v, err := h.s.CreateVariant(c.Request.Context(), id, variant)
+		if errors.Is(err, product.ErrParentNotFound) {
+			failure(c, 404, err)
+			return
+		}
+		if errors.Is(err, store.ErrDuplicateCode) {
+			duplicateCode(c, err)
+			return
+		}
+		if err != nil {
+			failure(c, 400, err)
+			return
+		}
+		web.Success(c, 201, v)
 	}
 }
 
 /* ---------------------------------- Utils --------------------------------- */
 
-// validateEmptys valida que los campos no esten vacios
+// includeDeleted lee la opcion include_deleted de la query
+func includeDeleted(c *gin.Context) (bool, error) {
+	value := c.Query("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	deleted, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("invalid include_deleted, must be true or false")
+	}
+	return deleted, nil
+}
+
+// bindBulk lee el array de un request en lote sin decodificar sus elementos, para que un elemento invalido se
+// informe en su resultado y no rechace el lote entero. Si el array es invalido responde 400 y devuelve false
+func bindBulk(c *gin.Context) ([]json.RawMessage, bool) {
+	var raw []json.RawMessage
+	if err := c.ShouldBindJSON(&raw); err != nil {
+		web.Failure(c, 400, errors.New("invalid json"))
+		return nil, false
+	}
+	if err := validateBulkSize(len(raw)); err != nil {
+		web.Failure(c, 400, err)
+		return nil, false
+	}
+	return raw, true
+}
+
+// bindError devuelve el error a informar cuando no se puede leer un producto: el de la fecha, el importe o la
+// moneda si alguno es invalido, y un error generico para el resto
+func bindError(err error) error {
+	if errors.Is(err, domain.ErrInvalidDate) || errors.Is(err, domain.ErrInvalidAmount) || errors.Is(err, domain.ErrInvalidCurrency) {
+		return err
+	}
+	return errors.New("invalid json")
+}
+
+// validateBulkSize valida la cantidad de elementos de un request en lote
+func validateBulkSize(n int) error {
+	if n == 0 || n > maxBulkItems {
+		return fmt.Errorf("invalid number of items, must be between 1 and %d", maxBulkItems)
+	}
+	return nil
+}
+
+// newBulkResult completa items, que ya tiene los elementos rechazados por validacion, con los resultados del
+// servicio; index indica a que elemento corresponde cada resultado y okStatus es el status de los exitosos
+func newBulkResult(items []bulkItem, index []int, results []store.BatchResult, okStatus int) bulkResult {
+	for j, r := range results {
+		item := bulkItem{Index: index[j], Id: r.Product.Id, Status: okStatus}
+		switch {
+		case r.Err == nil:
+			product := r.Product
+			item.Data = &product
+		case errors.Is(r.Err, store.ErrNotFound):
+			item.Status, item.Error = 404, r.Err.Error()
+		case errors.Is(r.Err, store.ErrVersionConflict), errors.Is(r.Err, product.ErrHasVariants):
+			item.Status, item.Error = 409, r.Err.Error()
+		case errors.Is(r.Err, store.ErrDuplicateCode):
+			item.Status, item.Error = 409, r.Err.Error()
+			var duplicate *store.DuplicateCodeError
+			if errors.As(r.Err, &duplicate) {
+				item.ConflictingId = duplicate.ConflictingId
+			}
+		default:
+			item.Status, item.Error = 400, r.Err.Error()
+		}
+		items[index[j]] = item
+	}
+	result := bulkResult{Items: items}
+	for _, item := range items {
+		if item.Error == "" {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	return result
+}
+
+// duplicateConflict son los datos de la respuesta 409 de un codigo repetido
+type duplicateConflict struct {
+	CodeValue     string    `json:"code_value"`
+	ConflictingId domain.ID `json:"conflicting_id"`
+}
+
+// duplicateCode responde 409 con el id del producto que ya usa el codigo
+func duplicateCode(c *gin.Context, err error) {
+	var duplicate *store.DuplicateCodeError
+	if !errors.As(err, &duplicate) {
+		failure(c, 409, err)
+		return
+	}
+	web.FailureWithData(c, 409, err, duplicateConflict{CodeValue: duplicate.CodeValue, ConflictingId: duplicate.ConflictingId})
+}
+
+// failure escribe la respuesta de error, o 504 si el request se quedo sin tiempo
+func failure(c *gin.Context, status int, err error) {
+	if errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		web.Failure(c, 504, errors.New("request timeout"))
+		return
+	}
+	web.Failure(c, status, err)
+}
+
+// expectedVersion toma la version esperada del header If-Match (el ETag de GetByID) si viene,
+// o deja la del campo version del body
+func expectedVersion(c *gin.Context, product *domain.Product) error {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version <= 0 {
+		return errors.New("invalid If-Match header, must be the product version")
+	}
+	if product.Version != 0 && product.Version != version {
+		return errors.New("If-Match header and version field don't match")
+	}
+	product.Version = version
+	return nil
+}
+
+// validateEmptys valida que los campos no esten vacios. Una variante no necesita nombre: usa el de su producto padre
 func validateEmptys(product *domain.Product) (bool, error) {
 	switch {
-	case product.Name == "":
+	case product.Name == "" && product.ParentId == "":
 		return false, errors.New("name can't be empty")
 	case product.CodeValue == "":
 		return false, errors.New("code_value can't be empty")
-	case product.Expiration == "":
+	case product.Expiration.IsZero():
 		return false, errors.New("expiration can't be empty")
-	case product.Quantity <= 0 || product.Price <= 0:
+	case product.Quantity <= 0 || product.Price.Amount <= 0:
 		if product.Quantity <= 0 {
 			return false, errors.New("quantity must be greater than 0")
 		}
-		if product.Price <= 0 {
+		if product.Price.Amount <= 0 {
 			return false, errors.New("price must be greater than 0")
 		}
 	}
 	return true, nil
 }
-
-// validateExpiration valida que la fecha de expiracion sea valida
-func validateExpiration(product *domain.Product) (bool, error) {
-	dates := strings.Split(product.Expiration, "-")
-	list := []int{}
-	if len(dates) != 3 {
-		return false, errors.New("invalid expiration date, must be in format: dd/mm/yyyy")
-	}
-	for value := range dates {
-		number, err := strconv.Atoi(dates[value])
-		if err != nil {
-			return false, errors.New("invalid expiration date, must be numbers")
-		}
-		list = append(list, number)
-	}
-	condition := (list[2] < 1 || list[2] > 31) && (list[1] < 1 || list[1] > 12) && (list[0] < 1 || list[0] > 9999)
-	if condition {
-		return false, errors.New("invalid expiration date, date must be between 1 and 31/12/9999")
-	}
-	return true, nil
-}
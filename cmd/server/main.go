@@ -3,15 +3,16 @@ package main
 import (
 	"clase19/cmd/server/handler"
 	"clase19/docs"
+	"clase19/internal/category"
+	"clase19/internal/domain"
 	"clase19/internal/product"
 	"clase19/pkg/middleware"
-	"clase19/pkg/store"
-	"database/sql"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -31,25 +32,51 @@ func main() {
 	if err := godotenv.Load(".env"); err != nil {
 		log.Fatal("error loading .env file")
 	}
+	// DATE_FORMATS lista separados por coma los formatos de fecha aceptados en los requests ademas de yyyy-mm-dd
+	// (por defecto dd/mm/yyyy). Los stores siempre leen yyyy-mm-dd y el dd/mm/yyyy de las fechas viejas de products.json
+	if formats := os.Getenv("DATE_FORMATS"); formats != "" {
+		if err := handler.SetDateFormats(strings.Split(formats, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// ROUNDING_MODE es el redondeo de los calculos de precios: half_up (por defecto), half_even, down o up
+	if mode := os.Getenv("ROUNDING_MODE"); mode != "" {
+		rounding, err := domain.ParseRoundingMode(mode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		domain.SetRounding(rounding)
+	}
+
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	db, err := sql.Open("mysql", os.Getenv("DB_URL"))
+	storage, history, categories, err := newStorage()
 	if err != nil {
 		panic(err.Error())
 	}
-	errPing := db.Ping()
-	if errPing != nil {
-		panic(errPing.Error())
-	}
-	storage := store.NewSqlStore(db)
-	// storage := store.NewJsonStore("../../products.json")
 
-	repo := product.NewRepository(storage)
-	service := product.NewService(repo)
+	categoryService := category.NewService(category.NewRepository(categories, storage))
+	categoryHandler := handler.NewCategoryHandler(categoryService)
+	repo := product.NewRepository(storage, history)
+	service := product.NewService(repo, categoryService)
 	productHandler := handler.NewProductHandler(service)
 
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(middleware.Logger())
+	r.Use(middleware.ReadYourWrites())
+	if timeout := os.Getenv("REQUEST_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatal("invalid REQUEST_TIMEOUT")
+		}
+		r.Use(middleware.Timeout(d))
+	}
 
 	r.GET("/ping", func(c *gin.Context) { c.String(200, "pong") })
 
@@ -64,9 +91,24 @@ func main() {
 		products.GET("/search", productHandler.Search())
 		products.GET("/consumer_price", productHandler.ConsumerPrice())
 		products.POST("", middleware.Authentication(), productHandler.Post())
+		products.POST("/bulk", middleware.Authentication(), productHandler.PostBulk())
+		products.PATCH("/bulk", middleware.Authentication(), productHandler.PatchBulk())
+		products.DELETE("/bulk", middleware.Authentication(), productHandler.DeleteBulk())
 		products.PUT(":id", middleware.Authentication(), productHandler.Put())
 		products.PATCH(":id", middleware.Authentication(), productHandler.Patch())
 		products.DELETE(":id", middleware.Authentication(), productHandler.Delete())
+		products.POST(":id/restore", middleware.Authentication(), productHandler.Restore())
+		products.GET(":id/history", middleware.Authentication(), productHandler.History())
+		products.GET(":id/variants", productHandler.Variants())
+		products.POST(":id/variants", middleware.Authentication(), productHandler.PostVariant())
+	}
+	categoryGroup := r.Group("/categories")
+	{
+		categoryGroup.GET("", categoryHandler.GetAll())
+		categoryGroup.GET(":id", categoryHandler.GetByID())
+		categoryGroup.POST("", middleware.Authentication(), categoryHandler.Post())
+		categoryGroup.PUT(":id", middleware.Authentication(), categoryHandler.Put())
+		categoryGroup.DELETE(":id", middleware.Authentication(), categoryHandler.Delete())
 	}
 	r.Run(":8080")
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"clase19/pkg/idgen"
+	"clase19/pkg/migrate"
+	"clase19/pkg/store"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newStorage crea el store configurado envuelto con el registro de historial y, si CACHE_TTL tiene una duracion
+// (ej. 30s), con un cache de lectura de hasta CACHE_SIZE productos, que con DB_REPLICA_URLS se llena desde la base
+// primaria. Devuelve tambien el historial para consultarlo y el store de categorias.
+func newStorage() (store.Store, store.HistoryLog, store.CategoryStore, error) {
+	storage, history, categories, err := newBackend()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	storage = store.NewHistoryStore(storage, history)
+	if os.Getenv("CACHE_TTL") == "" {
+		return storage, history, categories, nil
+	}
+	ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL"))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid CACHE_TTL: %w", err)
+	}
+	size, _ := strconv.Atoi(os.Getenv("CACHE_SIZE"))
+	return store.NewCachedStore(storage, ttl, size), history, categories, nil
+}
+
+// newBackend crea el store indicado en la variable STORE (sql, json, journal, events, bolt o memory) y su historial:
+// la tabla product_history para sql, el archivo PRODUCTS_PATH.history para json, journal y events, BOLT_PATH.history
+// para bolt y memoria para memory. Las categorias siguen el mismo criterio: la tabla categories, los archivos
+// PRODUCTS_PATH.categories o BOLT_PATH.categories, o memoria.
+// Para sql el motor se elige segun el esquema de DB_URL, y DB_REPLICA_URLS puede listar replicas de lectura
+// separadas por coma, que se comprueban cada REPLICA_CHECK_INTERVAL (5s por defecto).
+func newBackend() (store.Store, store.HistoryLog, store.CategoryStore, error) {
+	switch os.Getenv("STORE") {
+	case "json":
+		gen, err := newIDGenerator(productsPath() + ".seq")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return store.NewJsonStore(productsPath(), gen), store.NewFileHistory(productsPath() + ".history"), fileCategories(), nil
+	case "journal":
+		gen, err := newIDGenerator(productsPath() + ".seq")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		compactEvery, _ := strconv.Atoi(os.Getenv("JOURNAL_COMPACT_EVERY"))
+		storage, err := store.NewJournalStore(productsPath(), compactEvery, gen)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, store.NewFileHistory(productsPath() + ".history"), fileCategories(), nil
+	case "events":
+		gen, err := newIDGenerator(productsPath() + ".seq")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		projectionEvery, _ := strconv.Atoi(os.Getenv("EVENTS_PROJECTION_EVERY"))
+		storage, err := store.NewEventStore(eventsPath(), productsPath(), projectionEvery, gen)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, store.NewFileHistory(productsPath() + ".history"), fileCategories(), nil
+	case "bolt":
+		gen, err := newIDGenerator("")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		storage, err := store.NewBoltStore(boltPath(), productsPath(), gen)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, store.NewFileHistory(boltPath() + ".history"), store.NewFileCategories(boltPath() + ".categories"), nil
+	case "memory":
+		gen, err := newIDGenerator("")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		storage, err := store.NewMemoryStoreFromFile(productsPath(), gen)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return storage, store.NewMemoryHistory(), store.NewMemoryCategories(), nil
+	case "", "sql":
+		gen, err := newIDGenerator("")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		db, dialect, err := openDB()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if dialect == store.SQLite {
+			if os.Getenv("DB_REPLICA_URLS") != "" {
+				return nil, nil, nil, errors.New("read replicas are not supported for sqlite")
+			}
+			storage, err := store.NewSqliteStore(db, gen)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			return storage, store.NewSqlHistory(db, dialect), store.NewSqlCategories(db, dialect), nil
+		}
+		if os.Getenv("AUTO_MIGRATE") == "true" {
+			migrator, err := migrate.New(db, dialect.Name)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			count, err := migrator.Up()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			log.Printf("applied %d migrations", count)
+		}
+		replicas, err := openReplicas(dialect)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(replicas) > 0 {
+			checkEvery, _ := time.ParseDuration(os.Getenv("REPLICA_CHECK_INTERVAL"))
+			return store.NewReplicatedSqlStore(db, replicas, dialect, gen, checkEvery), store.NewSqlHistory(db, dialect), store.NewSqlCategories(db, dialect), nil
+		}
+		return store.NewSqlStore(db, dialect, gen), store.NewSqlHistory(db, dialect), store.NewSqlCategories(db, dialect), nil
+	}
+	return nil, nil, nil, fmt.Errorf("unknown store %q", os.Getenv("STORE"))
+}
+
+// newIDGenerator crea el generador de ids indicado en ID_STRATEGY (sequence, uuidv7 o ulid).
+// Para sequence usa una secuencia persistida en seqPath, o la propia del store si seqPath esta vacio.
+func newIDGenerator(seqPath string) (store.IDGenerator, error) {
+	switch os.Getenv("ID_STRATEGY") {
+	case "", "sequence":
+		if seqPath == "" {
+			return nil, nil
+		}
+		return idgen.NewFileSequence(seqPath)
+	case "uuidv7":
+		return idgen.NewUUIDv7(), nil
+	case "ulid":
+		return idgen.NewULID(), nil
+	}
+	return nil, fmt.Errorf("unknown id strategy %q", os.Getenv("ID_STRATEGY"))
+}
+
+// openDB abre la conexion indicada en DB_URL y comprueba que responda
+func openDB() (*sql.DB, store.Dialect, error) {
+	dialect, dsn, err := store.ParseDSN(os.Getenv("DB_URL"))
+	if err != nil {
+		return nil, store.Dialect{}, err
+	}
+	db, err := sql.Open(dialect.Driver, dsn)
+	if err != nil {
+		return nil, store.Dialect{}, err
+	}
+	if err = db.Ping(); err != nil {
+		return nil, store.Dialect{}, err
+	}
+	return db, dialect, nil
+}
+
+// openReplicas abre las replicas de DB_REPLICA_URLS, que deben ser del mismo motor que DB_URL. No comprueba
+// que respondan: el store las usa solo mientras responden al ping
+func openReplicas(primary store.Dialect) ([]*sql.DB, error) {
+	var replicas []*sql.DB
+	for _, url := range strings.Split(os.Getenv("DB_REPLICA_URLS"), ",") {
+		if strings.TrimSpace(url) == "" {
+			continue
+		}
+		dialect, dsn, err := store.ParseDSN(strings.TrimSpace(url))
+		if err != nil {
+			return nil, fmt.Errorf("invalid replica url: %w", err)
+		}
+		if dialect != primary {
+			return nil, fmt.Errorf("replica %s is not a %s database like DB_URL", dialect.Name, primary.Name)
+		}
+		db, err := sql.Open(dialect.Driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, db)
+	}
+	return replicas, nil
+}
+
+// productsPath devuelve la ruta del archivo de productos para los stores json, journal y memory
+func productsPath() string {
+	if path := os.Getenv("PRODUCTS_PATH"); path != "" {
+		return path
+	}
+	return "../../products.json"
+}
+
+// boltPath devuelve la ruta del archivo del store bolt: BOLT_PATH o, por defecto, PRODUCTS_PATH.bolt
+func boltPath() string {
+	if path := os.Getenv("BOLT_PATH"); path != "" {
+		return path
+	}
+	return productsPath() + ".bolt"
+}
+
+// fileCategories crea el store de categorias de los stores json, journal y events, en PRODUCTS_PATH.categories
+func fileCategories() store.CategoryStore {
+	return store.NewFileCategories(productsPath() + ".categories")
+}
+
+// eventsPath devuelve la ruta del log de eventos del store events
+func eventsPath() string {
+	return productsPath() + ".events"
+}
@@ -0,0 +1,72 @@
+package category
+
+import (
+	"context"
+
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+type Repository interface {
+	GetAll(ctx context.Context) ([]domain.Category, error)
+	GetByID(ctx context.Context, id domain.ID) (domain.Category, error)
+	Create(ctx context.Context, c domain.Category) (domain.Category, error)
+	Update(ctx context.Context, c domain.Category) error
+	Delete(ctx context.Context, id domain.ID) error
+	HasProducts(ctx context.Context, id domain.ID) (bool, error)
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+}
+
+type repository struct {
+	categories store.CategoryStore
+	products   store.Store
+}
+
+// NewRepository crea un nuevo repositorio de categorias. products es el store de productos, para saber si una
+// categoria esta en uso
+func NewRepository(categories store.CategoryStore, products store.Store) Repository {
+	return &repository{categories, products}
+}
+
+// GetAll devuelve todas las categorias
+func (r *repository) GetAll(ctx context.Context) ([]domain.Category, error) {
+	return r.categories.List(ctx)
+}
+
+// GetByID busca una categoria por su id
+func (r *repository) GetByID(ctx context.Context, id domain.ID) (domain.Category, error) {
+	return r.categories.Get(ctx, id)
+}
+
+// Create agrega una nueva categoria
+func (r *repository) Create(ctx context.Context, c domain.Category) (domain.Category, error) {
+	return r.categories.Add(ctx, c)
+}
+
+// Update modifica una categoria
+func (r *repository) Update(ctx context.Context, c domain.Category) error {
+	return r.categories.Update(ctx, c)
+}
+
+// Delete elimina una categoria
+func (r *repository) Delete(ctx context.Context, id domain.ID) error {
+	return r.categories.Delete(ctx, id)
+}
+
+// HasProducts indica si algun producto, incluso uno borrado, pertenece a la categoria
+func (r *repository) HasProducts(ctx context.Context, id domain.ID) (bool, error) {
+	q := store.Query{Limit: 1, IncludeDeleted: true}.Where("category_id", store.Eq, id)
+	products, err := r.products.Find(ctx, q)
+	if err != nil {
+		return false, err
+	}
+	return len(products) > 0, nil
+}
+
+// WithTx ejecuta fn con un repositorio sobre una transaccion del store de categorias, aislada de las demas
+// escrituras de categorias. Los productos no participan de la transaccion
+func (r *repository) WithTx(ctx context.Context, fn func(tx Repository) error) error {
+	return r.categories.WithTx(ctx, func(tx store.CategoryStore) error {
+		return fn(&repository{tx, r.products})
+	})
+}
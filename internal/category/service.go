@@ -0,0 +1,173 @@
+package category
+
+import (
+	"context"
+	"errors"
+
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+var (
+	// ErrParentNotFound se devuelve si la categoria padre indicada no existe
+	ErrParentNotFound = errors.New("parent category not found")
+	// ErrCycle se devuelve si una categoria pasaria a estar debajo de si misma o de una de sus subcategorias
+	ErrCycle = errors.New("a category can't be placed under itself or one of its subcategories")
+	// ErrHasChildren se devuelve al borrar una categoria que tiene subcategorias
+	ErrHasChildren = errors.New("category has subcategories, move or delete them first")
+	// ErrInUse se devuelve al borrar una categoria que tiene productos
+	ErrInUse = errors.New("category has products, move them to another category first")
+)
+
+type Service interface {
+	GetAll(ctx context.Context) ([]domain.Category, error)
+	GetByID(ctx context.Context, id domain.ID) (domain.Category, error)
+	Create(ctx context.Context, c domain.Category) (domain.Category, error)
+	Update(ctx context.Context, id domain.ID, c domain.Category) (domain.Category, error)
+	Delete(ctx context.Context, id domain.ID) error
+	Subtree(ctx context.Context, id domain.ID) ([]domain.ID, error)
+}
+
+type service struct {
+	r Repository
+}
+
+// NewService crea un nuevo servicio de categorias
+func NewService(r Repository) Service {
+	return &service{r}
+}
+
+// GetAll devuelve todas las categorias
+func (s *service) GetAll(ctx context.Context) ([]domain.Category, error) {
+	return s.r.GetAll(ctx)
+}
+
+// GetByID busca una categoria por su id
+func (s *service) GetByID(ctx context.Context, id domain.ID) (domain.Category, error) {
+	return s.r.GetByID(ctx, id)
+}
+
+// Create agrega una categoria, raiz o debajo de una existente
+func (s *service) Create(ctx context.Context, c domain.Category) (domain.Category, error) {
+	var created domain.Category
+	err := s.r.WithTx(ctx, func(tx Repository) error {
+		if c.ParentId != "" {
+			if _, err := tx.GetByID(ctx, c.ParentId); errors.Is(err, store.ErrCategoryNotFound) {
+				return ErrParentNotFound
+			} else if err != nil {
+				return err
+			}
+		}
+		var err error
+		created, err = tx.Create(ctx, c)
+		return err
+	})
+	if err != nil {
+		return domain.Category{}, err
+	}
+	return created, nil
+}
+
+// Update cambia el nombre y la categoria padre, sin permitir que el arbol forme un ciclo. El control y la
+// escritura van en la misma transaccion, para que dos movimientos concurrentes no formen un ciclo entre ambos
+func (s *service) Update(ctx context.Context, id domain.ID, c domain.Category) (domain.Category, error) {
+	c.Id = id
+	err := s.r.WithTx(ctx, func(tx Repository) error {
+		categories, err := tx.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err = findCategory(categories, id); err != nil {
+			return err
+		}
+		if c.ParentId != "" {
+			if _, err = findCategory(categories, c.ParentId); err != nil {
+				return ErrParentNotFound
+			}
+			for _, descendant := range subtree(categories, id) {
+				if descendant == c.ParentId {
+					return ErrCycle
+				}
+			}
+		}
+		return tx.Update(ctx, c)
+	})
+	if err != nil {
+		return domain.Category{}, err
+	}
+	return c, nil
+}
+
+// Delete elimina una categoria que no tiene subcategorias ni productos. Los productos se controlan antes de la
+// transaccion de categorias, que no los incluye (en sqlite, con una sola conexion, leerlos dentro la bloquearia).
+// En las bases sql la clave foranea de products.category_id rechaza el borrado si un producto tomo la categoria
+// despues del control, y lo mismo el alta o modificacion de un producto con una categoria recien borrada
+func (s *service) Delete(ctx context.Context, id domain.ID) error {
+	used, err := s.r.HasProducts(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.r.WithTx(ctx, func(tx Repository) error {
+		categories, err := tx.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err = findCategory(categories, id); err != nil {
+			return err
+		}
+		if len(subtree(categories, id)) > 1 {
+			return ErrHasChildren
+		}
+		if used {
+			return ErrInUse
+		}
+		if err = tx.Delete(ctx, id); errors.Is(err, store.ErrCategoryInUse) {
+			return ErrInUse
+		}
+		return err
+	})
+}
+
+// Subtree devuelve el id de la categoria seguido de los de todas sus subcategorias, a cualquier profundidad
+func (s *service) Subtree(ctx context.Context, id domain.ID) ([]domain.ID, error) {
+	categories, err := s.r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = findCategory(categories, id); err != nil {
+		return nil, err
+	}
+	return subtree(categories, id), nil
+}
+
+// findCategory busca una categoria en la lista
+func findCategory(categories []domain.Category, id domain.ID) (domain.Category, error) {
+	for _, c := range categories {
+		if c.Id == id {
+			return c, nil
+		}
+	}
+	return domain.Category{}, store.ErrCategoryNotFound
+}
+
+// subtree recorre el arbol a lo ancho desde id y devuelve id y todos sus descendientes. Cada categoria se visita
+// una sola vez, asi un ciclo que ya este guardado no hace que el recorrido no termine
+func subtree(categories []domain.Category, id domain.ID) []domain.ID {
+	children := map[domain.ID][]domain.ID{}
+	for _, c := range categories {
+		if c.ParentId != "" {
+			children[c.ParentId] = append(children[c.ParentId], c.Id)
+		}
+	}
+	ids := []domain.ID{id}
+	visited := map[domain.ID]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !visited[child] {
+				visited[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
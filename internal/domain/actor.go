@@ -0,0 +1,18 @@
+package domain
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor guarda en el contexto quien hace el request, para registrarlo en el historial de cambios
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom devuelve quien hace el request, o "system" si el cambio no viene de un request autenticado
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "system"
+}
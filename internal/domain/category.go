@@ -0,0 +1,8 @@
+package domain
+
+// Category agrupa productos. Las categorias forman un arbol: ParentId vacio indica una categoria raiz
+type Category struct {
+	Id       ID     `json:"id"`
+	Name     string `json:"name"`
+	ParentId ID     `json:"parent_id,omitempty"`
+}
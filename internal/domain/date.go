@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout es el formato canonico de las fechas: el que se guarda en todos los stores y se escribe en json
+const DateLayout = "2006-01-02"
+
+// ErrInvalidDate es el error de una fecha mal escrita o que no existe en el calendario
+var ErrInvalidDate = errors.New("invalid date")
+
+// LegacyDateLayout es el formato dd/mm/yyyy de las fechas viejas de products.json, que se sigue leyendo de los stores
+const LegacyDateLayout = "02/01/2006"
+
+// Date es una fecha de calendario sin hora ni zona. El valor cero representa una fecha vacia
+type Date struct {
+	t time.Time
+}
+
+// NewDate crea una fecha; los valores fuera de rango se normalizan como en time.Date
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate interpreta una fecha guardada en un store: en formato yyyy-mm-dd o en el dd/mm/yyyy de las fechas
+// viejas. Rechaza las fechas que no existen en el calendario, como el 30/02
+func ParseDate(s string) (Date, error) {
+	return ParseDateWith(s, []string{LegacyDateLayout})
+}
+
+// ParseDateWith interpreta una fecha en formato yyyy-mm-dd o en alguno de los layouts de time dados, en orden
+func ParseDateWith(s string, layouts []string) (Date, error) {
+	layouts = append([]string{DateLayout}, layouts...)
+	for _, layout := range layouts {
+		// time.Parse ya rechaza los dias fuera del mes, como el 31/04, o el 29/02 fuera de los bisiestos
+		if t, err := time.Parse(layout, s); err == nil {
+			return NewDate(t.Date()), nil
+		}
+	}
+	accepted := make([]string, len(layouts))
+	for i, layout := range layouts {
+		accepted[i] = strings.NewReplacer("02", "dd", "01", "mm", "2006", "yyyy").Replace(layout)
+	}
+	return Date{}, fmt.Errorf("%w %q, must be a valid date in format %s", ErrInvalidDate, s, strings.Join(accepted, " or "))
+}
+
+// IsZero indica si la fecha esta vacia
+func (d Date) IsZero() bool {
+	return d.t.IsZero()
+}
+
+// Before indica si la fecha es anterior a other
+func (d Date) Before(other Date) bool {
+	return d.t.Before(other.t)
+}
+
+// Time devuelve el comienzo del dia en UTC
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// String devuelve la fecha en el formato canonico, o "" si esta vacia
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format(DateLayout)
+}
+
+// MarshalJSON escribe la fecha en el formato canonico; la fecha vacia se escribe como ""
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON acepta la fecha en los formatos de ParseDate; "" y null son la fecha vacia
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if string(data) != "null" {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("%w, must be a string", ErrInvalidDate)
+		}
+	}
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+	date, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
+
+// Value implementa driver.Valuer: las columnas DATE reciben el formato canonico
+func (d Date) Value() (driver.Value, error) {
+	if d.IsZero() {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+// Scan implementa sql.Scanner, ya que segun el driver la columna llega como time.Time o como texto
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = NewDate(v.Date())
+		return nil
+	case []byte:
+		return d.scanText(string(v))
+	case string:
+		return d.scanText(v)
+	case nil:
+		*d = Date{}
+		return nil
+	}
+	return fmt.Errorf("unsupported date type %T", src)
+}
+
+// scanText lee una fecha de texto, descartando la hora que agregan algunos drivers (ej. 2021-05-24T00:00:00Z)
+func (d *Date) scanText(s string) error {
+	if len(s) > len(DateLayout) {
+		s = s[:len(DateLayout)]
+	}
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return err
+	}
+	*d = NewDate(t.Date())
+	return nil
+}
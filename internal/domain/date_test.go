@@ -0,0 +1,100 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+// TestParseDate comprueba los formatos que se leen de los stores y el rechazo de las fechas que no existen
+func TestParseDate(t *testing.T) {
+	cases := []struct {
+		in   string
+		want domain.Date
+		ok   bool
+	}{
+		{"2030-05-24", domain.NewDate(2030, time.May, 24), true},
+		{"24/05/2030", domain.NewDate(2030, time.May, 24), true},
+		{"2024-02-29", domain.NewDate(2024, time.February, 29), true},
+		{"29/02/2024", domain.NewDate(2024, time.February, 29), true},
+		{"2023-02-29", domain.Date{}, false},
+		{"29/02/2023", domain.Date{}, false},
+		{"1900-02-29", domain.Date{}, false},
+		{"2000-02-29", domain.NewDate(2000, time.February, 29), true},
+		{"31/04/2030", domain.Date{}, false},
+		{"2030-04-31", domain.Date{}, false},
+		{"2030-13-01", domain.Date{}, false},
+		{"00/01/2030", domain.Date{}, false},
+		{"05/24/2030", domain.Date{}, false},
+		{"2030/05/24", domain.Date{}, false},
+		{"24-05-2030", domain.Date{}, false},
+		{"", domain.Date{}, false},
+	}
+	for _, c := range cases {
+		got, err := domain.ParseDate(c.in)
+		if !c.ok {
+			if !errors.Is(err, domain.ErrInvalidDate) {
+				t.Errorf("ParseDate(%q) = %v, %v, want ErrInvalidDate", c.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", c.in, got, err, c.want)
+		}
+	}
+}
+
+// TestParseDateWithOrder comprueba que ante una fecha ambigua gane el primer layout y que el canonico se acepte siempre
+func TestParseDateWithOrder(t *testing.T) {
+	us, eu := "01/02/2006", domain.LegacyDateLayout
+	cases := []struct {
+		in      string
+		layouts []string
+		want    domain.Date
+	}{
+		{"03/04/2030", []string{us, eu}, domain.NewDate(2030, time.March, 4)},
+		{"03/04/2030", []string{eu, us}, domain.NewDate(2030, time.April, 3)},
+		{"31/12/2030", []string{us, eu}, domain.NewDate(2030, time.December, 31)},
+		{"12/31/2030", []string{eu, us}, domain.NewDate(2030, time.December, 31)},
+		{"2030-03-04", []string{us}, domain.NewDate(2030, time.March, 4)},
+		{"2030-03-04", nil, domain.NewDate(2030, time.March, 4)},
+	}
+	for _, c := range cases {
+		got, err := domain.ParseDateWith(c.in, c.layouts)
+		if err != nil || got != c.want {
+			t.Errorf("ParseDateWith(%q, %v) = %v, %v, want %v", c.in, c.layouts, got, err, c.want)
+		}
+	}
+	if _, err := domain.ParseDateWith("31/12/2030", []string{us}); !errors.Is(err, domain.ErrInvalidDate) {
+		t.Errorf("day first date with only mm/dd/yyyy returned %v, want ErrInvalidDate", err)
+	}
+	if _, err := domain.ParseDateWith("29/02/2023", []string{eu, us}); !errors.Is(err, domain.ErrInvalidDate) {
+		t.Errorf("29/02/2023 returned %v, want ErrInvalidDate", err)
+	}
+}
+
+// TestDateJSON comprueba que la fecha se escriba en el formato canonico y que "" y null sean la fecha vacia
+func TestDateJSON(t *testing.T) {
+	var d domain.Date
+	if err := json.Unmarshal([]byte(`"24/05/2030"`), &d); err != nil || d != domain.NewDate(2030, time.May, 24) {
+		t.Fatalf("unmarshal 24/05/2030 = %v, %v", d, err)
+	}
+	out, err := json.Marshal(d)
+	if err != nil || string(out) != `"2030-05-24"` {
+		t.Fatalf("marshal = %s, %v, want \"2030-05-24\"", out, err)
+	}
+	for _, empty := range []string{`""`, `null`} {
+		d = domain.NewDate(2030, time.May, 24)
+		if err := json.Unmarshal([]byte(empty), &d); err != nil || !d.IsZero() {
+			t.Errorf("unmarshal %s = %v, %v, want the empty date", empty, d, err)
+		}
+	}
+	for _, bad := range []string{`"31/04/2030"`, `20300524`, `"tomorrow"`} {
+		if err := json.Unmarshal([]byte(bad), &d); !errors.Is(err, domain.ErrInvalidDate) {
+			t.Errorf("unmarshal %s returned %v, want ErrInvalidDate", bad, err)
+		}
+	}
+}
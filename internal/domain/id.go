@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ID identifica un producto. Segun la estrategia de generacion es numerico (secuencia) o textual (UUIDv7, ULID)
+type ID string
+
+// ParseID valida un id recibido en el path o en la query
+func ParseID(s string) (ID, error) {
+	if s == "" || len(s) > 64 {
+		return "", errors.New("invalid id")
+	}
+	for _, r := range s {
+		valid := (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '-'
+		if !valid {
+			return "", errors.New("invalid id")
+		}
+	}
+	return ID(s), nil
+}
+
+// IntID convierte un id numerico de la secuencia en ID
+func IntID(n int64) ID {
+	return ID(strconv.FormatInt(n, 10))
+}
+
+// Int devuelve el valor de un id numerico, y false si el id no es de la secuencia
+func (id ID) Int() (int64, bool) {
+	if !id.numeric() {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Less ordena los ids numericos por valor y el resto en orden lexicografico,
+// que para UUIDv7 y ULID coincide con el orden de creacion
+func (id ID) Less(other ID) bool {
+	if id.numeric() && other.numeric() && len(id) != len(other) {
+		return len(id) < len(other)
+	}
+	return id < other
+}
+
+// MarshalJSON escribe los ids numericos como numero para mantener el formato de products.json
+func (id ID) MarshalJSON() ([]byte, error) {
+	if _, ok := id.Int(); ok {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON acepta el id como numero o como texto
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = ID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	if _, err := n.Int64(); err != nil {
+		return errors.New("invalid id")
+	}
+	*id = ID(n.String())
+	return nil
+}
+
+// numeric indica si el id es un numero sin ceros a la izquierda
+func (id ID) numeric() bool {
+	if id == "" || (len(id) > 1 && id[0] == '0') {
+		return false
+	}
+	for _, r := range id {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
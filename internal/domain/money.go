@@ -0,0 +1,284 @@
+package domain
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCurrency es la moneda de los precios que no la indican, como los de products.json
+const DefaultCurrency = "ARS"
+
+// amountScale es la cantidad fija de decimales de los importes
+const amountScale = 2
+
+// ErrInvalidAmount es el error de un importe mal escrito o con mas decimales de los admitidos
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// ErrInvalidCurrency es el error de un codigo de moneda que no tiene la forma ISO 4217
+var ErrInvalidCurrency = errors.New("invalid currency")
+
+// ErrCurrencyMismatch se devuelve al operar importes de distintas monedas
+var ErrCurrencyMismatch = errors.New("currencies don't match")
+
+// RoundingMode es la forma de redondear un importe a centavos
+type RoundingMode int
+
+const (
+	// RoundHalfUp redondea al centavo mas cercano, y los empates lejos de cero
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven redondea al centavo mas cercano, y los empates al centavo par
+	RoundHalfEven
+	// RoundDown trunca hacia cero
+	RoundDown
+	// RoundUp redondea lejos de cero
+	RoundUp
+)
+
+var roundingModes = map[string]RoundingMode{
+	"half_up":   RoundHalfUp,
+	"half_even": RoundHalfEven,
+	"down":      RoundDown,
+	"up":        RoundUp,
+}
+
+var (
+	roundingMu sync.RWMutex
+	rounding   = RoundHalfUp
+)
+
+// ParseRoundingMode interpreta un modo de redondeo: half_up, half_even, down o up
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	mode, ok := roundingModes[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid rounding mode %q, must be half_up, half_even, down or up", s)
+	}
+	return mode, nil
+}
+
+// SetRounding configura el modo de redondeo de los calculos de precios; por defecto es half_up
+func SetRounding(mode RoundingMode) {
+	roundingMu.Lock()
+	defer roundingMu.Unlock()
+	rounding = mode
+}
+
+// Rounding devuelve el modo de redondeo configurado
+func Rounding() RoundingMode {
+	roundingMu.RLock()
+	defer roundingMu.RUnlock()
+	return rounding
+}
+
+// Amount es un importe exacto en centavos. En json se escribe como texto con dos decimales (ej. "71.42")
+type Amount int64
+
+// ParseAmount interpreta un importe decimal como 71.42, -3 o 0.5. Rechaza los de mas de dos decimales
+func ParseAmount(s string) (Amount, error) {
+	text := strings.TrimPrefix(s, "-")
+	whole, frac := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		whole, frac = text[:i], text[i+1:]
+	}
+	if whole == "" || len(frac) > amountScale || (strings.Contains(text, ".") && frac == "") {
+		return 0, fmt.Errorf("%w %q, must be a number with up to %d decimals", ErrInvalidAmount, s, amountScale)
+	}
+	frac += strings.Repeat("0", amountScale-len(frac))
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || strings.ContainsAny(whole+frac, "+-") {
+		return 0, fmt.Errorf("%w %q, must be a number with up to %d decimals", ErrInvalidAmount, s, amountScale)
+	}
+	if strings.HasPrefix(s, "-") {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+// AmountFromFloat convierte un float al centavo mas cercano, para los valores que llegan como numero de punto flotante
+func AmountFromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// String escribe el importe con dos decimales
+func (a Amount) String() string {
+	sign, cents := "", int64(a)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON escribe el importe como texto para que ningun cliente lo lea como float
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON acepta el importe como texto o como numero, sin pasar por float
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	amount, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value implementa driver.Valuer: las columnas DECIMAL reciben el texto exacto
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implementa sql.Scanner: DECIMAL llega como texto y REAL (sqlite) como float64
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case float64:
+		*a = AmountFromFloat(v)
+		return nil
+	case int64:
+		*a = Amount(v * 100)
+		return nil
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	}
+	return fmt.Errorf("unsupported amount type %T", src)
+}
+
+// scanText lee un DECIMAL, que algunos motores devuelven con ceros de mas (ej. 71.4200)
+func (a *Amount) scanText(s string) error {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Money es un importe exacto con su moneda, un codigo ISO 4217 como ARS o USD
+type Money struct {
+	Amount   Amount `json:"amount" swaggertype:"string" example:"71.42"`
+	Currency string `json:"currency" example:"ARS"`
+}
+
+// NewMoney crea un importe en la moneda indicada
+func NewMoney(amount Amount, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ValidCurrency indica si el codigo tiene la forma de un codigo ISO 4217: tres letras mayusculas
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZero indica si el precio esta vacio, sin importe ni moneda
+func (m Money) IsZero() bool {
+	return m.Amount == 0 && m.Currency == ""
+}
+
+// Add suma dos importes de la misma moneda
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// MulRatio multiplica el importe por num/den, exacto hasta el redondeo final a centavos con mode.
+// Por ejemplo MulRatio(121, 100, mode) agrega un 21%
+func (m Money) MulRatio(num, den int64, mode RoundingMode) (Money, error) {
+	if den == 0 {
+		return Money{}, errors.New("ratio with zero denominator")
+	}
+	product := new(big.Int).Mul(big.NewInt(int64(m.Amount)), big.NewInt(num))
+	d := big.NewInt(den)
+	if d.Sign() < 0 {
+		product.Neg(product)
+		d.Neg(d)
+	}
+	q, r := new(big.Int).QuoRem(product, d, new(big.Int))
+	if r.Sign() != 0 && roundAway(q, r, d, mode) {
+		q.Add(q, big.NewInt(int64(product.Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, fmt.Errorf("%w: result out of range", ErrInvalidAmount)
+	}
+	return Money{Amount: Amount(q.Int64()), Currency: m.Currency}, nil
+}
+
+// roundAway decide si el cociente truncado q, con resto r distinto de cero sobre d, se aleja de cero
+func roundAway(q, r, d *big.Int, mode RoundingMode) bool {
+	switch mode {
+	case RoundDown:
+		return false
+	case RoundUp:
+		return true
+	}
+	twice := new(big.Int).Abs(r)
+	switch twice.Lsh(twice, 1).Cmp(d) {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	// empate exacto a medio centavo
+	return mode == RoundHalfUp || q.Bit(0) == 1
+}
+
+// String escribe el precio como importe y moneda, ej. 71.42 ARS
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency
+}
+
+// UnmarshalJSON acepta el objeto {"amount": "71.42", "currency": "ARS"} o, como en products.json, solo el
+// importe, que se toma en DefaultCurrency. Un objeto sin moneda deja Currency vacio
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*m = Money{}
+		return nil
+	}
+	if len(data) > 0 && data[0] != '{' {
+		var amount Amount
+		if err := amount.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		*m = Money{Amount: amount, Currency: DefaultCurrency}
+		return nil
+	}
+	type money Money
+	var v money
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Currency != "" && !ValidCurrency(v.Currency) {
+		return fmt.Errorf("%w %q, must be an ISO 4217 code like ARS or USD", ErrInvalidCurrency, v.Currency)
+	}
+	*m = Money(v)
+	return nil
+}
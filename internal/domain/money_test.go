@@ -0,0 +1,100 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"clase19/internal/domain"
+)
+
+// TestParseAmount comprueba los importes aceptados y el rechazo de los mal escritos o con mas de dos decimales
+func TestParseAmount(t *testing.T) {
+	valid := []struct {
+		in   string
+		want domain.Amount
+	}{
+		{"71.42", 7142},
+		{"71.4", 7140},
+		{"71", 7100},
+		{"0.5", 50},
+		{"-3", -300},
+		{"-0.05", -5},
+		{"0", 0},
+		{"9999999999.99", 999999999999},
+	}
+	for _, c := range valid {
+		got, err := domain.ParseAmount(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", c.in, got, err, c.want)
+		}
+	}
+	for _, in := range []string{"1.234", "--5", "1.", ".5", "-", "", "+5", "-+5", "1.-5", "1e3", " 1", "1,5", "abc", "99999999999999999999"} {
+		if got, err := domain.ParseAmount(in); !errors.Is(err, domain.ErrInvalidAmount) {
+			t.Errorf("ParseAmount(%q) = %d, %v, want ErrInvalidAmount", in, got, err)
+		}
+	}
+}
+
+// TestAmountString comprueba que el importe se escriba con dos decimales y el signo delante
+func TestAmountString(t *testing.T) {
+	cases := map[domain.Amount]string{7142: "71.42", 5: "0.05", -5: "-0.05", -7100: "-71.00", 0: "0.00"}
+	for amount, want := range cases {
+		if got := amount.String(); got != want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(amount), got, want)
+		}
+	}
+}
+
+// TestMulRatio comprueba los cuatro modos de redondeo en empates, fuera de empates y con importes negativos
+func TestMulRatio(t *testing.T) {
+	modes := []domain.RoundingMode{domain.RoundHalfUp, domain.RoundHalfEven, domain.RoundDown, domain.RoundUp}
+	cases := []struct {
+		name     string
+		amount   domain.Amount
+		num, den int64
+		// want es el resultado en cada modo, en el orden de modes
+		want [4]domain.Amount
+	}{
+		{"tie to even below", 5, 1, 2, [4]domain.Amount{3, 2, 2, 3}},
+		{"tie to even above", 7, 1, 2, [4]domain.Amount{4, 4, 3, 4}},
+		{"negative tie", -5, 1, 2, [4]domain.Amount{-3, -2, -2, -3}},
+		{"negative tie to even above", -7, 1, 2, [4]domain.Amount{-4, -4, -3, -4}},
+		{"negative denominator", 5, 1, -2, [4]domain.Amount{-3, -2, -2, -3}},
+		{"below half", 10, 1, 3, [4]domain.Amount{3, 3, 3, 4}},
+		{"above half", 20, 1, 3, [4]domain.Amount{7, 7, 6, 7}},
+		{"negative below half", -10, 1, 3, [4]domain.Amount{-3, -3, -3, -4}},
+		{"negative above half", -20, 1, 3, [4]domain.Amount{-7, -7, -6, -7}},
+		{"exact", 1000, 121, 100, [4]domain.Amount{1210, 1210, 1210, 1210}},
+		{"surcharge tie", 50, 121, 100, [4]domain.Amount{61, 60, 60, 61}},
+		{"surcharge", 7142, 121, 100, [4]domain.Amount{8642, 8642, 8641, 8642}},
+	}
+	for _, c := range cases {
+		for i, mode := range modes {
+			got, err := domain.NewMoney(c.amount, "ARS").MulRatio(c.num, c.den, mode)
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if got.Amount != c.want[i] || got.Currency != "ARS" {
+				t.Errorf("%s: %d * %d/%d in mode %d = %s, want %d", c.name, int64(c.amount), c.num, c.den, mode, got, int64(c.want[i]))
+			}
+		}
+	}
+	if _, err := domain.NewMoney(100, "ARS").MulRatio(1, 0, domain.RoundHalfUp); err == nil {
+		t.Error("MulRatio with zero denominator succeeded")
+	}
+	if _, err := domain.NewMoney(1<<62, "ARS").MulRatio(4, 1, domain.RoundHalfUp); !errors.Is(err, domain.ErrInvalidAmount) {
+		t.Errorf("MulRatio out of range returned %v, want ErrInvalidAmount", err)
+	}
+}
+
+// TestParseRoundingMode comprueba los nombres de los modos de redondeo
+func TestParseRoundingMode(t *testing.T) {
+	for name, want := range map[string]domain.RoundingMode{"half_up": domain.RoundHalfUp, "half_even": domain.RoundHalfEven, "down": domain.RoundDown, "up": domain.RoundUp} {
+		if got, err := domain.ParseRoundingMode(name); err != nil || got != want {
+			t.Errorf("ParseRoundingMode(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	if _, err := domain.ParseRoundingMode("nearest"); err == nil {
+		t.Error("ParseRoundingMode accepted an unknown mode")
+	}
+}
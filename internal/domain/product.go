@@ -1,11 +1,24 @@
 package domain
 
+import "time"
+
 type Product struct {
-	Id          int     `json:"id"`
-	Name        string  `json:"name" `
-	Quantity    int     `json:"quantity" `
-	CodeValue   string  `json:"code_value"`
-	IsPublished bool    `json:"is_published"`
-	Expiration  string  `json:"expiration" `
-	Price       float64 `json:"price"`
+	Id          ID     `json:"id"`
+	Name        string `json:"name" `
+	Quantity    int    `json:"quantity" `
+	CodeValue   string `json:"code_value"`
+	IsPublished bool   `json:"is_published"`
+	Expiration  Date   `json:"expiration" swaggertype:"string" example:"2021-05-24"`
+	Price       Money  `json:"price"`
+	// Version empieza en 1 y aumenta con cada modificacion; al actualizar indica la version que el cliente leyo
+	Version int `json:"version"`
+	// CategoryId es la categoria del producto; vacio si no tiene
+	CategoryId ID `json:"category_id,omitempty"`
+	// ParentId es el producto padre de una variante, con el que comparte nombre y categoria; vacio si no es una
+	// variante. No cambia despues del alta. Product no tiene descripcion, asi que no hay otro dato que heredar
+	ParentId ID `json:"parent_id,omitempty"`
+	// Variant distingue a la variante de las otras del mismo padre (ej. 750 ml o pack x6)
+	Variant string `json:"variant,omitempty" example:"pack x6"`
+	// DeletedAt es la fecha de borrado; los productos borrados se ocultan hasta que se restauran o se purgan
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
@@ -1,35 +1,52 @@
 package product
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"clase19/internal/domain"
 	"clase19/pkg/store"
 )
 
 type Repository interface {
-	GetAll() []domain.Product
-	GetByID(id int) (domain.Product, error)
-	SearchPriceGt(price float64) []domain.Product
-	ConsumerPrice(listIdsInt []int) ([]domain.Product, float64, error)
-	Create(p domain.Product) (domain.Product, error)
-	UpdateProduct(id int, updatedProduct domain.Product) (domain.Product, error)
-	Delete(id int) error
+	GetAll(ctx context.Context, includeDeleted bool) []domain.Product
+	GetByID(ctx context.Context, id domain.ID) (domain.Product, error)
+	SearchPriceGt(ctx context.Context, price domain.Amount, includeDeleted bool) []domain.Product
+	GetByCategories(ctx context.Context, categories []domain.ID, includeDeleted bool) ([]domain.Product, error)
+	GetVariants(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error)
+	ConsumerPrice(ctx context.Context, listIds []domain.ID) ([]domain.Product, domain.Money, error)
+	Create(ctx context.Context, p domain.Product) (domain.Product, error)
+	UpdateProduct(ctx context.Context, id domain.ID, updatedProduct domain.Product) (domain.Product, error)
+	Delete(ctx context.Context, id domain.ID) error
+	CreateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error)
+	UpdateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error)
+	DeleteMany(ctx context.Context, ids []domain.ID) ([]store.BatchResult, error)
+	Restore(ctx context.Context, id domain.ID) (domain.Product, error)
+	Purge(ctx context.Context, retention time.Duration) (int, error)
+	History(ctx context.Context, id domain.ID, limit, offset int) ([]store.HistoryEntry, int, error)
 }
 
 type repository struct {
 	storage store.Store
+	history store.HistoryLog
 }
 
-// NewRepository crea un nuevo repositorio
-func NewRepository(storage store.Store) Repository {
-	return &repository{storage}
+// NewRepository crea un nuevo repositorio. history es donde el store registra los cambios de cada producto
+func NewRepository(storage store.Store, history store.HistoryLog) Repository {
+	return &repository{storage, history}
 }
 
-// GetAll devuelve todos los productos
-func (r *repository) GetAll() []domain.Product {
-	products, err := r.storage.GetAll()
+// GetAll devuelve todos los productos, incluyendo los borrados si includeDeleted es true
+func (r *repository) GetAll(ctx context.Context, includeDeleted bool) []domain.Product {
+	var products []domain.Product
+	var err error
+	if includeDeleted {
+		products, err = r.storage.Find(ctx, store.Query{IncludeDeleted: true})
+	} else {
+		products, err = r.storage.GetAll(ctx)
+	}
 	if err != nil {
 		return []domain.Product{}
 	}
@@ -37,127 +54,416 @@ func (r *repository) GetAll() []domain.Product {
 }
 
 // GetByID busca un producto por su id
-func (r *repository) GetByID(id int) (domain.Product, error) {
-	product, err := r.storage.GetOne(id)
+func (r *repository) GetByID(ctx context.Context, id domain.ID) (domain.Product, error) {
+	product, err := r.storage.GetOne(ctx, id)
 	if err != nil {
-		return domain.Product{}, errors.New(fmt.Sprintf("product %d not found", id))
+		return domain.Product{}, errors.New(fmt.Sprintf("product %s not found", id))
 	}
 	return product, nil
 }
 
 // SearchPriceGt busca productos por precio mayor o igual que el precio dado
-func (r *repository) SearchPriceGt(price float64) []domain.Product {
-	var products []domain.Product
-	list, err := r.storage.GetAll()
+func (r *repository) SearchPriceGt(ctx context.Context, price domain.Amount, includeDeleted bool) []domain.Product {
+	q := store.Query{IncludeDeleted: includeDeleted}.Where("price", store.Gt, price).OrderBy("id", false)
+	products, err := r.storage.Find(ctx, q)
 	if err != nil {
-		return products
-	}
-	for _, product := range list {
-		if product.Price > price {
-			products = append(products, product)
-		}
+		return nil
 	}
 	return products
 }
 
-// ConsumerPrice devuelve el precio de una lista de productos
-func (r *repository) ConsumerPrice(listIdsInt []int) ([]domain.Product, float64, error) {
+// GetByCategories busca los productos de cualquiera de las categorias dadas
+func (r *repository) GetByCategories(ctx context.Context, categories []domain.ID, includeDeleted bool) ([]domain.Product, error) {
+	q := store.Query{IncludeDeleted: includeDeleted}.Where("category_id", store.In, categories).OrderBy("id", false)
+	return r.storage.Find(ctx, q)
+}
+
+// GetVariants busca las variantes de un producto, ordenadas por id
+func (r *repository) GetVariants(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error) {
+	q := store.Query{IncludeDeleted: includeDeleted}.Where("parent_id", store.Eq, id).OrderBy("id", false)
+	return r.storage.Find(ctx, q)
+}
+
+// ConsumerPrice devuelve el precio de una lista de productos. Es una cotizacion: el stock se descuenta solo en
+// los productos devueltos, sin guardarse, y la transaccion de solo lectura (REPEATABLE READ en las bases sql)
+// asegura que todos se lean del mismo estado.
+// Una variante se puede comprar solo si su producto padre tambien esta publicado
+func (r *repository) ConsumerPrice(ctx context.Context, listIds []domain.ID) ([]domain.Product, domain.Money, error) {
 	cant := 0
-	price := 0.0
+	var price domain.Money
 	var products []domain.Product
-	for _, id := range listIdsInt {
-		flag := true
-		for k, p := range products {
-			if id == p.Id {
-				if p.Quantity <= 0 {
-					return []domain.Product{}, 0, errors.New(fmt.Sprintf("product(%d) stock not available", p.Id))
+	err := r.storage.WithTx(store.WithSnapshot(ctx), func(tx store.Store) error {
+		for _, id := range listIds {
+			flag := true
+			for k, p := range products {
+				if id == p.Id {
+					if p.Quantity <= 0 {
+						return errors.New(fmt.Sprintf("product(%s) stock not available", p.Id))
+					}
+					products[k].Quantity -= 1
+					var err error
+					if price, err = addPrice(price, p.Price); err != nil {
+						return err
+					}
+					cant++
+					flag = false
+					break
 				}
-				products[k].Quantity -= 1
-				price += p.Price
-				cant++
-				flag = false
-				break
 			}
-		}
-		if flag {
-			product, err := r.GetByID(id)
-			if err != nil {
-				return []domain.Product{}, 0, err
-			}
-			err = validProduct(product)
-			if err != nil {
-				return []domain.Product{}, 0, err
+			if flag {
+				product, err := tx.GetOne(ctx, id)
+				if err != nil {
+					return errors.New(fmt.Sprintf("product %s not found", id))
+				}
+				err = validProduct(product)
+				if err != nil {
+					return err
+				}
+				if err = validParent(ctx, tx, product); err != nil {
+					return err
+				}
+				product.Quantity -= 1
+				products = append(products, product)
+				if price, err = addPrice(price, product.Price); err != nil {
+					return err
+				}
+				cant++
 			}
-			product.Quantity -= 1
-			products = append(products, product)
-			price += product.Price
-			cant++
 		}
+		return nil
+	})
+	if err != nil {
+		return []domain.Product{}, domain.Money{}, err
 	}
+	// el recargo se calcula sobre el total exacto y se redondea una sola vez, con el modo configurado
 	if cant <= 10 {
-		price *= 1.21
+		price, err = price.MulRatio(121, 100, domain.Rounding())
 	} else if cant > 10 && cant < 20 {
-		price *= 1.17
+		price, err = price.MulRatio(117, 100, domain.Rounding())
 	} else {
-		price *= 1.15
+		price, err = price.MulRatio(115, 100, domain.Rounding())
+	}
+	if err != nil {
+		return []domain.Product{}, domain.Money{}, err
 	}
 	return products, price, nil
 }
 
-// Create agrega un nuevo producto
-func (r *repository) Create(p domain.Product) (domain.Product, error) {
-	if !r.validateCodeValue(p.CodeValue) {
-		return domain.Product{}, errors.New("code value already exists")
+// addPrice suma un precio al total; el total vacio toma la moneda del primer precio
+func addPrice(total, price domain.Money) (domain.Money, error) {
+	if total.IsZero() {
+		return price, nil
 	}
-	product, err := r.storage.AddOne(p)
+	sum, err := total.Add(price)
 	if err != nil {
-		return domain.Product{}, errors.New("error creating product")
+		return domain.Money{}, errors.New("products with different currencies can't be priced together")
+	}
+	return sum, nil
+}
+
+// Create agrega un nuevo producto. Si el codigo ya existe devuelve el *store.DuplicateCodeError del store.
+// Una variante toma el nombre y la categoria de su producto padre, que se lee y se bloquea en la misma
+// transaccion del alta para que no se borre mientras tanto
+func (r *repository) Create(ctx context.Context, p domain.Product) (domain.Product, error) {
+	var product domain.Product
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		variant, err := lockParent(ctx, tx, p)
+		if err != nil {
+			return err
+		}
+		product, err = tx.AddOne(ctx, variant)
+		if errors.Is(err, store.ErrDuplicateCode) || errors.Is(err, store.ErrCategoryNotFound) {
+			return err
+		}
+		if err != nil {
+			return errors.New("error creating product")
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.Product{}, err
 	}
 	return product, nil
 }
 
-// validateCodeValue valida que el codigo no exista en la lista de productos
-func (r *repository) validateCodeValue(codeValue string) bool {
-	list, err := r.storage.GetAll()
+// UpdateProduct actualiza un producto y devuelve como quedo, todo en una misma transaccion.
+// Si updatedProduct trae una version vieja devuelve store.ErrVersionConflict, y si toma el codigo
+// de otro producto el *store.DuplicateCodeError del store
+func (r *repository) UpdateProduct(ctx context.Context, id domain.ID, updatedProduct domain.Product) (domain.Product, error) {
+	var product domain.Product
+	updatedProduct.Id = id
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		err := tx.UpdateOne(ctx, updatedProduct)
+		if errors.Is(err, store.ErrVersionConflict) || errors.Is(err, store.ErrDuplicateCode) || errors.Is(err, store.ErrCategoryNotFound) {
+			return err
+		}
+		if err != nil {
+			return errors.New("error updating product")
+		}
+		product, err = tx.GetOne(ctx, id)
+		if err != nil {
+			return errors.New("error updating product")
+		}
+		return syncVariants(ctx, tx, product)
+	})
 	if err != nil {
-		return false
+		return domain.Product{}, err
 	}
-	for _, product := range list {
-		if product.CodeValue == codeValue {
-			return false
+	return product, nil
+}
+
+// Delete busca un producto por su id y lo marca como borrado. Si tiene variantes sin borrar devuelve
+// ErrHasVariants. El producto queda bloqueado desde el control hasta el borrado, y como el alta de una variante
+// bloquea a su padre, una variante nueva espera al borrado y despues no lo encuentra
+func (r *repository) Delete(ctx context.Context, id domain.ID) error {
+	return r.storage.WithTx(ctx, func(tx store.Store) error {
+		if err := checkVariants(ctx, tx, id, nil); err != nil {
+			return err
+		}
+		return tx.DeleteOne(ctx, id)
+	})
+}
+
+// CreateMany agrega los productos en una misma transaccion. Los de codigo repetido o producto padre invalido
+// se informan en su resultado; los padres de las variantes quedan bloqueados como en Create
+func (r *repository) CreateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error) {
+	var results []store.BatchResult
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		results = make([]store.BatchResult, len(products))
+		var valid []domain.Product
+		var index []int
+		for i, p := range products {
+			variant, err := lockParent(ctx, tx, p)
+			if errors.Is(err, ErrParentNotFound) || errors.Is(err, ErrNestedVariant) {
+				results[i] = store.BatchResult{Product: p, Err: err}
+				continue
+			} else if err != nil {
+				return err
+			}
+			valid = append(valid, variant)
+			index = append(index, i)
+		}
+		added, err := tx.AddMany(ctx, valid)
+		if err != nil {
+			return err
+		}
+		for j, result := range added {
+			results[index[j]] = result
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return true
+	return results, nil
 }
 
-// UpdateProduct actualiza un producto
-func (r *repository) UpdateProduct(id int, updatedProduct domain.Product) (domain.Product, error) {
-	if !r.validateCodeValue(updatedProduct.CodeValue) {
-		return domain.Product{}, errors.New("code value already exists")
+// UpdateMany actualiza los productos en una misma transaccion. Los que pasarian a usar el codigo de otro
+// producto se informan en su resultado
+func (r *repository) UpdateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error) {
+	var results []store.BatchResult
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		var err error
+		if results, err = tx.UpdateMany(ctx, products); err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			if err = syncVariants(ctx, tx, result.Product); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	err := r.storage.UpdateOne(updatedProduct)
+	return results, nil
+}
+
+// DeleteMany marca los productos como borrados en una misma transaccion. Los que tienen variantes sin borrar
+// que no estan en ids se informan en su resultado con ErrHasVariants
+func (r *repository) DeleteMany(ctx context.Context, ids []domain.ID) ([]store.BatchResult, error) {
+	var results []store.BatchResult
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		results = make([]store.BatchResult, len(ids))
+		var valid []domain.ID
+		var index []int
+		for i, id := range ids {
+			if err := checkVariants(ctx, tx, id, ids); errors.Is(err, ErrHasVariants) {
+				results[i] = store.BatchResult{Product: domain.Product{Id: id}, Err: err}
+				continue
+			} else if err != nil {
+				return err
+			}
+			valid = append(valid, id)
+			index = append(index, i)
+		}
+		deleted, err := tx.DeleteMany(ctx, valid)
+		if err != nil {
+			return err
+		}
+		for j, result := range deleted {
+			results[index[j]] = result
+		}
+		return nil
+	})
 	if err != nil {
-		return domain.Product{}, errors.New("error updating product")
+		return nil, err
 	}
-	return updatedProduct, nil
+	return results, nil
 }
 
-// Delete busca un producto por su id y lo elimina
-func (r *repository) Delete(id int) error {
-	err := r.storage.DeleteOne(id)
+// Restore deshace el borrado de un producto y lo devuelve. Una variante solo se restaura si su producto padre
+// no esta borrado, y vuelve con el nombre y la categoria actuales del padre
+func (r *repository) Restore(ctx context.Context, id domain.ID) (domain.Product, error) {
+	var product domain.Product
+	err := r.storage.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.Restore(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		if product, err = tx.GetOne(ctx, id); err != nil || product.ParentId == "" {
+			return err
+		}
+		parent, err := lockProduct(ctx, tx, product.ParentId)
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrParentNotFound, product.ParentId)
+		}
+		if err != nil {
+			return err
+		}
+		if product.Name == parent.Name && product.CategoryId == parent.CategoryId {
+			return nil
+		}
+		if err = tx.UpdateOne(ctx, domain.Product{Id: id, Name: parent.Name, CategoryId: parent.CategoryId}); err != nil {
+			return err
+		}
+		product, err = tx.GetOne(ctx, id)
+		return err
+	})
+	if err != nil {
+		return domain.Product{}, err
+	}
+	return product, nil
+}
+
+// Purge elimina definitivamente los productos borrados hace mas de retention
+func (r *repository) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	return r.storage.Purge(ctx, time.Now().Add(-retention))
+}
+
+// History devuelve una pagina del historial de cambios de un producto, de lo mas nuevo a lo mas viejo, y el total.
+// Los productos borrados conservan su historial; si el producto no existe devuelve store.ErrNotFound
+func (r *repository) History(ctx context.Context, id domain.ID, limit, offset int) ([]store.HistoryEntry, int, error) {
+	found, err := r.storage.Find(ctx, store.Query{Limit: 1, IncludeDeleted: true}.Where("id", store.Eq, id))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(found) == 0 {
+		return nil, 0, store.ErrNotFound
+	}
+	return r.history.List(ctx, id, limit, offset)
+}
+
+// checkVariants devuelve ErrHasVariants si el producto tiene variantes sin borrar, salvo las incluidas en batch
+func checkVariants(ctx context.Context, tx store.Store, id domain.ID, batch []domain.ID) error {
+	if _, err := lockProduct(ctx, tx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	variants, err := tx.Find(ctx, store.Query{ForUpdate: true}.Where("parent_id", store.Eq, id))
+	if err != nil {
+		return err
+	}
+	for _, v := range variants {
+		included := false
+		for _, other := range batch {
+			included = included || other == v.Id
+		}
+		if !included {
+			return ErrHasVariants
+		}
+	}
+	return nil
+}
+
+// lockProduct lee un producto sin borrar y lo bloquea hasta el fin de la transaccion, o devuelve store.ErrNotFound
+func lockProduct(ctx context.Context, tx store.Store, id domain.ID) (domain.Product, error) {
+	found, err := tx.Find(ctx, store.Query{Limit: 1, ForUpdate: true}.Where("id", store.Eq, id))
+	if err != nil {
+		return domain.Product{}, err
+	}
+	if len(found) == 0 {
+		return domain.Product{}, store.ErrNotFound
+	}
+	return found[0], nil
+}
+
+// lockParent bloquea el producto padre de una variante y le completa el nombre y la categoria con los del padre.
+// Devuelve ErrParentNotFound si el padre no existe o esta borrado y ErrNestedVariant si tambien es una variante
+func lockParent(ctx context.Context, tx store.Store, p domain.Product) (domain.Product, error) {
+	if p.ParentId == "" {
+		return p, nil
+	}
+	parent, err := lockProduct(ctx, tx, p.ParentId)
+	if errors.Is(err, store.ErrNotFound) {
+		return domain.Product{}, fmt.Errorf("%w: %s", ErrParentNotFound, p.ParentId)
+	}
+	if err != nil {
+		return domain.Product{}, err
+	}
+	if parent.ParentId != "" {
+		return domain.Product{}, ErrNestedVariant
+	}
+	p.Name, p.CategoryId = parent.Name, parent.CategoryId
+	return p, nil
+}
+
+// validParent comprueba que el producto padre de una variante exista y este publicado
+func validParent(ctx context.Context, tx store.Store, product domain.Product) error {
+	if product.ParentId == "" {
+		return nil
+	}
+	parent, err := tx.GetOne(ctx, product.ParentId)
+	if err != nil {
+		return errors.New(fmt.Sprintf("product(%s) is not available", product.Id))
+	}
+	if !parent.IsPublished {
+		return errors.New(fmt.Sprintf("product(%s) is not published", product.Id))
+	}
+	return nil
+}
+
+// syncVariants copia a las variantes de parent su nombre y su categoria, que son compartidos.
+// No hace nada si parent es una variante
+func syncVariants(ctx context.Context, tx store.Store, parent domain.Product) error {
+	if parent.ParentId != "" {
+		return nil
+	}
+	variants, err := tx.Find(ctx, store.Query{}.Where("parent_id", store.Eq, parent.Id))
 	if err != nil {
 		return err
 	}
+	for _, v := range variants {
+		if v.Name == parent.Name && v.CategoryId == parent.CategoryId {
+			continue
+		}
+		if err = tx.UpdateOne(ctx, domain.Product{Id: v.Id, Name: parent.Name, CategoryId: parent.CategoryId}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // validProduct comprueba si un producto cumple con los requisitos para ser comprado
 func validProduct(product domain.Product) error {
 	if product.Quantity <= 0 {
-		return errors.New(fmt.Sprintf("product(%d) stock not available", product.Id))
+		return errors.New(fmt.Sprintf("product(%s) stock not available", product.Id))
 	}
 	if !product.IsPublished {
-		return errors.New(fmt.Sprintf("product(%d) is not published", product.Id))
+		return errors.New(fmt.Sprintf("product(%s) is not published", product.Id))
 	}
 	return nil
 }
@@ -0,0 +1,99 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+// TestConsumerPriceSurcharge comprueba el recargo segun la cantidad de productos: 21% hasta 10, 17% entre 11 y 19
+// y 15% desde 20, calculado sobre el total exacto
+func TestConsumerPriceSurcharge(t *testing.T) {
+	ctx := context.Background()
+	r := NewRepository(store.NewMemoryStore(nil, nil), store.NewMemoryHistory())
+	product, err := r.Create(ctx, domain.Product{Name: "priced", Quantity: 100, CodeValue: "PRICED1", IsPublished: true, Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(3333, domain.DefaultCurrency)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		count int
+		want  domain.Amount
+	}{
+		{1, 4033},   // 33.33 * 1.21 = 40.3293
+		{10, 40329}, // 333.30 * 1.21 = 403.293
+		{11, 42896}, // 366.63 * 1.17 = 428.9571
+		{19, 74093}, // 633.27 * 1.17 = 740.9259
+		{20, 76659}, // 666.60 * 1.15 = 766.59
+		{21, 80492}, // 699.93 * 1.15 = 804.9195
+	}
+	for _, c := range cases {
+		ids := make([]domain.ID, c.count)
+		for i := range ids {
+			ids[i] = product.Id
+		}
+		products, price, err := r.ConsumerPrice(ctx, ids)
+		if err != nil {
+			t.Fatalf("%d products: %v", c.count, err)
+		}
+		if price != domain.NewMoney(c.want, domain.DefaultCurrency) {
+			t.Errorf("%d products cost %s, want %s", c.count, price, domain.NewMoney(c.want, domain.DefaultCurrency))
+		}
+		if len(products) != 1 || products[0].Quantity != 100-c.count {
+			t.Errorf("%d products returned %+v, want the product with %d left", c.count, products, 100-c.count)
+		}
+	}
+}
+
+// TestVariantParent comprueba que el alta de una variante lea al padre en su transaccion: toma su nombre y
+// categoria, y falla si el padre es una variante o ya esta borrado, tambien dentro de un lote
+func TestVariantParent(t *testing.T) {
+	ctx := context.Background()
+	r := NewRepository(store.NewMemoryStore(nil, nil), store.NewMemoryHistory())
+	product := func(code string, parent domain.ID) domain.Product {
+		return domain.Product{Name: code, Quantity: 1, CodeValue: code, Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(100, domain.DefaultCurrency), CategoryId: "7", ParentId: parent}
+	}
+	parent, err := r.Create(ctx, product("PARENT", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant, err := r.Create(ctx, product("VARIANT", parent.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variant.Name != parent.Name || variant.CategoryId != parent.CategoryId || variant.ParentId != parent.Id {
+		t.Errorf("variant %+v doesn't take the name and category of %+v", variant, parent)
+	}
+	if _, err = r.Create(ctx, product("NESTED", variant.Id)); !errors.Is(err, ErrNestedVariant) {
+		t.Errorf("variant of a variant returned %v, want ErrNestedVariant", err)
+	}
+	if err = r.Delete(ctx, parent.Id); !errors.Is(err, ErrHasVariants) {
+		t.Errorf("deleting a parent with variants returned %v, want ErrHasVariants", err)
+	}
+	results, err := r.DeleteMany(ctx, []domain.ID{variant.Id, parent.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("deleting %s with its variant returned %v", result.Product.Id, result.Err)
+		}
+	}
+	if _, err = r.Create(ctx, product("ORPHAN", parent.Id)); !errors.Is(err, ErrParentNotFound) {
+		t.Errorf("variant of a deleted product returned %v, want ErrParentNotFound", err)
+	}
+	other, err := r.Create(ctx, product("OTHER", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = r.CreateMany(ctx, []domain.Product{product("MANY1", parent.Id), product("MANY2", other.Id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || !errors.Is(results[0].Err, ErrParentNotFound) || results[1].Err != nil || results[1].Product.Name != other.Name {
+		t.Errorf("batch with a deleted and a live parent returned %+v", results)
+	}
+}
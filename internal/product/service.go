@@ -1,48 +1,104 @@
 package product
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
+	"clase19/internal/category"
 	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+var (
+	// ErrParentNotFound se devuelve si el producto padre de una variante no existe o esta borrado
+	ErrParentNotFound = errors.New("parent product not found")
+	// ErrNestedVariant se devuelve al crear una variante de otra variante
+	ErrNestedVariant = errors.New("a variant can't have variants")
+	// ErrSharedField se devuelve al cambiar el nombre o la categoria de una variante, que se toman del producto padre
+	ErrSharedField = errors.New("name and category of a variant are shared with its parent product, update the parent instead")
+	// ErrHasVariants se devuelve al borrar un producto que tiene variantes
+	ErrHasVariants = errors.New("product has variants, delete them first")
 )
 
 type Service interface {
-	GetAll() ([]domain.Product, error)
-	GetByID(id int) (domain.Product, error)
-	SearchPriceGt(price float64) ([]domain.Product, error)
-	ConsumerPrice(listIdsInt []int) ([]domain.Product, float64, error)
-	Create(p domain.Product) (domain.Product, error)
-	UpdateProduct(id int, updatedProduct domain.Product) (domain.Product, error)
-	Delete(id int) error
+	GetAll(ctx context.Context, includeDeleted bool) ([]domain.Product, error)
+	GetByID(ctx context.Context, id domain.ID) (domain.Product, error)
+	GetByCategory(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error)
+	Variants(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error)
+	CreateVariant(ctx context.Context, parentId domain.ID, variant domain.Product) (domain.Product, error)
+	SearchPriceGt(ctx context.Context, price domain.Amount, includeDeleted bool) ([]domain.Product, error)
+	ConsumerPrice(ctx context.Context, listIds []domain.ID) ([]domain.Product, domain.Money, error)
+	Create(ctx context.Context, p domain.Product) (domain.Product, error)
+	UpdateProduct(ctx context.Context, id domain.ID, updatedProduct domain.Product) (domain.Product, error)
+	Delete(ctx context.Context, id domain.ID) error
+	CreateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error)
+	UpdateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error)
+	DeleteMany(ctx context.Context, ids []domain.ID) ([]store.BatchResult, error)
+	Restore(ctx context.Context, id domain.ID) (domain.Product, error)
+	Purge(ctx context.Context, retention time.Duration) (int, error)
+	History(ctx context.Context, id domain.ID, limit, offset int) ([]store.HistoryEntry, int, error)
 }
 
 type service struct {
-	r Repository
+	r          Repository
+	categories category.Service
 }
 
-// NewService crea un nuevo servicio
-func NewService(r Repository) Service {
-	return &service{r}
+// NewService crea un nuevo servicio. categories se usa para validar la categoria de los productos y para
+// buscar los productos de una categoria y sus subcategorias
+func NewService(r Repository, categories category.Service) Service {
+	return &service{r, categories}
 }
 
 // GetAll devuelve todos los productos
-func (s *service) GetAll() ([]domain.Product, error) {
-	l := s.r.GetAll()
+func (s *service) GetAll(ctx context.Context, includeDeleted bool) ([]domain.Product, error) {
+	l := s.r.GetAll(ctx, includeDeleted)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return l, nil
 }
 
 // GetByID busca un producto por su id
-func (s *service) GetByID(id int) (domain.Product, error) {
-	p, err := s.r.GetByID(id)
+func (s *service) GetByID(ctx context.Context, id domain.ID) (domain.Product, error) {
+	p, err := s.r.GetByID(ctx, id)
 	if err != nil {
 		return domain.Product{}, err
 	}
 	return p, nil
 }
 
+// GetByCategory devuelve los productos de la categoria y de todas sus subcategorias
+func (s *service) GetByCategory(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error) {
+	ids, err := s.categories.Subtree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.r.GetByCategories(ctx, ids, includeDeleted)
+}
+
+// Variants devuelve las variantes de un producto
+func (s *service) Variants(ctx context.Context, id domain.ID, includeDeleted bool) ([]domain.Product, error) {
+	if _, err := s.r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.r.GetVariants(ctx, id, includeDeleted)
+}
+
+// CreateVariant agrega una variante de parentId, que toma el nombre y la categoria del padre
+func (s *service) CreateVariant(ctx context.Context, parentId domain.ID, variant domain.Product) (domain.Product, error) {
+	variant.ParentId = parentId
+	return s.Create(ctx, variant)
+}
+
 // SearchPriceGt busca productos por precio mayor que el precio dado
-func (s *service) SearchPriceGt(price float64) ([]domain.Product, error) {
-	l := s.r.SearchPriceGt(price)
+func (s *service) SearchPriceGt(ctx context.Context, price domain.Amount, includeDeleted bool) ([]domain.Product, error) {
+	l := s.r.SearchPriceGt(ctx, price, includeDeleted)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if len(l) == 0 {
 		return []domain.Product{}, errors.New("no products found")
 	}
@@ -50,37 +106,183 @@ func (s *service) SearchPriceGt(price float64) ([]domain.Product, error) {
 }
 
 // ConsumerPrice devuelve el precio de una lista de productos
-func (s *service) ConsumerPrice(listIdsInt []int) ([]domain.Product, float64, error) {
-	products, price, err := s.r.ConsumerPrice(listIdsInt)
+func (s *service) ConsumerPrice(ctx context.Context, listIds []domain.ID) ([]domain.Product, domain.Money, error) {
+	products, price, err := s.r.ConsumerPrice(ctx, listIds)
 	if err != nil {
 		return products, price, err
 	}
 	return products, price, nil
 }
 
-// Create agrega un nuevo producto
-func (s *service) Create(p domain.Product) (domain.Product, error) {
-	p, err := s.r.Create(p)
+// Create agrega un nuevo producto; si el precio no indica moneda se toma domain.DefaultCurrency.
+// Si indica parent_id se agrega como variante de ese producto
+func (s *service) Create(ctx context.Context, p domain.Product) (domain.Product, error) {
+	p, err := s.checkCreate(ctx, p)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	p, err = s.r.Create(ctx, withCurrency(p))
 	if err != nil {
 		return domain.Product{}, err
 	}
 	return p, nil
 }
 
-// UpdateProduct actualiza un producto
-func (s *service) UpdateProduct(id int, updatedProduct domain.Product) (domain.Product, error) {
-	p, err := s.r.UpdateProduct(id, updatedProduct)
+// UpdateProduct actualiza un producto. Los cambios de nombre y categoria de un producto padre pasan a sus variantes
+func (s *service) UpdateProduct(ctx context.Context, id domain.ID, updatedProduct domain.Product) (domain.Product, error) {
+	updatedProduct.Id = id
+	updatedProduct, err := s.checkUpdate(ctx, updatedProduct)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	p, err := s.r.UpdateProduct(ctx, id, updatedProduct)
 	if err != nil {
 		return domain.Product{}, err
 	}
 	return p, nil
 }
 
-// Delete busca un producto por su id y lo elimina
-func (s *service) Delete(id int) error {
-	err := s.r.Delete(id)
+// Delete busca un producto por su id y lo elimina. Un producto con variantes no se puede borrar
+func (s *service) Delete(ctx context.Context, id domain.ID) error {
+	err := s.r.Delete(ctx, id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// CreateMany agrega varios productos y devuelve el resultado de cada uno. Los de categoria o producto padre
+// inexistente se informan en su resultado sin agregarse
+func (s *service) CreateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error) {
+	for i := range products {
+		products[i] = withCurrency(products[i])
+	}
+	return s.checkBatch(ctx, products, s.checkCreate, s.r.CreateMany)
+}
+
+// UpdateMany actualiza varios productos y devuelve el resultado de cada uno
+func (s *service) UpdateMany(ctx context.Context, products []domain.Product) ([]store.BatchResult, error) {
+	for _, p := range products {
+		if p.Id == "" {
+			return nil, errors.New("every product needs an id")
+		}
+	}
+	return s.checkBatch(ctx, products, s.checkUpdate, s.r.UpdateMany)
+}
+
+// DeleteMany elimina varios productos y devuelve el resultado de cada uno. Un producto con variantes solo se
+// borra si el lote incluye todas sus variantes
+func (s *service) DeleteMany(ctx context.Context, ids []domain.ID) ([]store.BatchResult, error) {
+	return s.r.DeleteMany(ctx, ids)
+}
+
+// Restore deshace el borrado de un producto
+func (s *service) Restore(ctx context.Context, id domain.ID) (domain.Product, error) {
+	p, err := s.r.Restore(ctx, id)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	return p, nil
+}
+
+// Purge elimina definitivamente los productos borrados hace mas de retention
+func (s *service) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	if retention < 0 {
+		return 0, errors.New("retention can't be negative")
+	}
+	return s.r.Purge(ctx, retention)
+}
+
+// History devuelve una pagina del historial de cambios de un producto y el total de cambios
+func (s *service) History(ctx context.Context, id domain.ID, limit, offset int) ([]store.HistoryEntry, int, error) {
+	if limit <= 0 || offset < 0 {
+		return nil, 0, errors.New("invalid limit or offset")
+	}
+	return s.r.History(ctx, id, limit, offset)
+}
+
+// checkCategory valida que exista la categoria del producto, si tiene
+func (s *service) checkCategory(ctx context.Context, p domain.Product) error {
+	if p.CategoryId == "" {
+		return nil
+	}
+	_, err := s.categories.GetByID(ctx, p.CategoryId)
+	if errors.Is(err, store.ErrCategoryNotFound) {
+		return fmt.Errorf("%w: %s", store.ErrCategoryNotFound, p.CategoryId)
+	}
+	return err
+}
+
+// checkCreate valida la categoria de un producto nuevo. Una variante toma la categoria de su producto padre,
+// que el repositorio lee y bloquea en la transaccion del alta, asi que no se valida aca
+func (s *service) checkCreate(ctx context.Context, p domain.Product) (domain.Product, error) {
+	if p.ParentId != "" {
+		return p, nil
+	}
+	return p, s.checkCategory(ctx, p)
+}
+
+// checkUpdate valida la categoria de un producto modificado y que no se cambien los campos compartidos de
+// una variante. El producto padre de una variante no se puede cambiar, asi que se ignora
+func (s *service) checkUpdate(ctx context.Context, p domain.Product) (domain.Product, error) {
+	p.ParentId = ""
+	if err := s.checkCategory(ctx, p); err != nil {
+		return domain.Product{}, err
+	}
+	if p.Name == "" && p.CategoryId == "" {
+		return p, nil
+	}
+	current, err := s.r.GetByID(ctx, p.Id)
+	if err != nil {
+		// el store informa el producto inexistente al actualizar
+		return p, nil
+	}
+	if current.ParentId != "" && ((p.Name != "" && p.Name != current.Name) || (p.CategoryId != "" && p.CategoryId != current.CategoryId)) {
+		return domain.Product{}, ErrSharedField
+	}
+	return p, nil
+}
+
+// checkBatch pasa a batch solo los productos que check acepta, como check los deja, y devuelve los resultados en
+// el orden de products, con el error de validacion en el resultado de los rechazados
+func (s *service) checkBatch(ctx context.Context, products []domain.Product, check func(context.Context, domain.Product) (domain.Product, error), batch func(context.Context, []domain.Product) ([]store.BatchResult, error)) ([]store.BatchResult, error) {
+	results := make([]store.BatchResult, len(products))
+	var valid []domain.Product
+	var index []int
+	for i, p := range products {
+		checked, err := check(ctx, p)
+		if itemError(err) {
+			results[i] = store.BatchResult{Product: p, Err: err}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		valid = append(valid, checked)
+		index = append(index, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	batchResults, err := batch(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, r := range batchResults {
+		results[index[j]] = r
+	}
+	return results, nil
+}
+
+// itemError indica si un error de validacion afecta solo a un producto de un lote
+func itemError(err error) bool {
+	return errors.Is(err, store.ErrCategoryNotFound) || errors.Is(err, ErrParentNotFound) || errors.Is(err, ErrNestedVariant) || errors.Is(err, ErrSharedField)
+}
+
+// withCurrency completa la moneda del precio con domain.DefaultCurrency si no la tiene
+func withCurrency(p domain.Product) domain.Product {
+	if p.Price.Currency == "" {
+		p.Price.Currency = domain.DefaultCurrency
+	}
+	return p
+}
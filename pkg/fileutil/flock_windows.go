@@ -0,0 +1,35 @@
+//go:build windows
+
+package fileutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Lock toma un bloqueo advisory sobre path con LockFileEx, exclusivo o compartido, y devuelve la funcion que lo libera
+func Lock(path string, exclusive bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	handle := windows.Handle(file.Fd())
+	if err = windows.LockFileEx(handle, flags, 0, 1, 0, &windows.Overlapped{}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		windows.UnLockEx(handle, 0, 1, 0, &windows.Overlapped{})
+		file.Close()
+	}, nil
+}
+
+// syncDir no hace nada en windows, donde los directorios no se pueden sincronizar
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package idgen
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
+)
+
+// Sequence genera ids numericos crecientes en memoria
+type Sequence struct {
+	mu   sync.Mutex
+	last int64
+}
+
+// NewSequence crea una secuencia que empieza despues de last
+func NewSequence(last int64) *Sequence {
+	return &Sequence{last: last}
+}
+
+// NewID devuelve el siguiente numero de la secuencia
+func (s *Sequence) NewID(ctx context.Context) (domain.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return domain.IntID(s.last), nil
+}
+
+// Observe avanza la secuencia para no repetir un id numerico ya existente
+func (s *Sequence) Observe(id domain.ID) {
+	n, ok := id.Int()
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > s.last {
+		s.last = n
+	}
+}
+
+// FileSequence es una secuencia numerica que guarda el ultimo valor entregado en un archivo,
+// por lo que no repite ids aunque se borre el ultimo producto y se reinicie el servidor.
+// Varios procesos pueden compartir el archivo: cada id se toma con un bloqueo advisory sobre path.lock
+type FileSequence struct {
+	mu   sync.Mutex
+	path string
+	// last es el mayor id observado en los productos; el archivo puede ir mas adelante por otros procesos
+	last int64
+}
+
+// NewFileSequence crea una secuencia persistida en path, retomando el valor guardado si existe
+func NewFileSequence(path string) (*FileSequence, error) {
+	last, err := readSequence(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSequence{path: path, last: last}, nil
+}
+
+// readSequence lee el ultimo valor guardado en path; 0 si el archivo no existe
+func readSequence(path string) (int64, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	last, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sequence file %s: %w", path, err)
+	}
+	return last, nil
+}
+
+// NewID devuelve el siguiente numero de la secuencia despues de guardarlo. Con el archivo bloqueado relee el
+// valor guardado, que puede haber avanzado otro proceso, y sigue al mayor entre ese y el mayor id observado
+func (s *FileSequence) NewID(ctx context.Context) (domain.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := fileutil.Lock(s.path+".lock", true)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	last, err := readSequence(s.path)
+	if err != nil {
+		return "", err
+	}
+	if s.last > last {
+		last = s.last
+	}
+	if err = fileutil.WriteAtomic(s.path, []byte(strconv.FormatInt(last+1, 10)), 0644); err != nil {
+		return "", err
+	}
+	s.last = last + 1
+	return domain.IntID(s.last), nil
+}
+
+// Observe avanza la secuencia para no repetir un id numerico ya existente
+func (s *FileSequence) Observe(id domain.ID) {
+	n, ok := id.Int()
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > s.last {
+		s.last = n
+	}
+}
+
+type uuidV7 struct{}
+
+// NewUUIDv7 crea un generador de UUID version 7 (RFC 9562): ordenables por fecha de creacion y no adivinables
+func NewUUIDv7() *uuidV7 {
+	return &uuidV7{}
+}
+
+// NewID devuelve un nuevo UUIDv7
+func (g *uuidV7) NewID(ctx context.Context) (domain.ID, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	putMillis(b[:6], time.Now())
+	b[6] = 0x70 | (b[6] & 0x0f)
+	b[8] = 0x80 | (b[8] & 0x3f)
+	h := hex.EncodeToString(b[:])
+	return domain.ID(h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]), nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulid struct{}
+
+// NewULID crea un generador de ULID: 26 caracteres en base32 de Crockford, ordenables por fecha de creacion
+func NewULID() *ulid {
+	return &ulid{}
+}
+
+// NewID devuelve un nuevo ULID
+func (g *ulid) NewID(ctx context.Context) (domain.ID, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	putMillis(b[:6], time.Now())
+	// 128 bits en 26 caracteres de 5 bits: el primero solo usa los 3 bits mas altos
+	out := make([]byte, 26)
+	out[0] = crockford[b[0]>>5]
+	acc := uint64(b[0] & 0x1f)
+	bits := 5
+	i := 1
+	for _, v := range b[1:] {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[i] = crockford[(acc>>uint(bits))&0x1f]
+			i++
+		}
+	}
+	return domain.ID(out), nil
+}
+
+// putMillis escribe los milisegundos unix de t en 48 bits big endian
+func putMillis(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
@@ -0,0 +1,44 @@
+package idgen_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"clase19/internal/domain"
+	"clase19/pkg/idgen"
+)
+
+// TestFileSequenceShared comprueba que dos secuencias sobre el mismo archivo, como dos procesos, no repitan ids
+func TestFileSequenceShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "products.seq")
+	a, err := idgen.NewFileSequence(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := idgen.NewFileSequence(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	seen := map[domain.ID]bool{}
+	for i := 0; i < 5; i++ {
+		for _, seq := range []*idgen.FileSequence{a, b} {
+			id, err := seq.NewID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[id] {
+				t.Fatalf("id %s issued twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	b.Observe("100")
+	if id, _ := b.NewID(ctx); id != "101" {
+		t.Fatalf("got %s after observing 100, want 101", id)
+	}
+	if id, _ := a.NewID(ctx); id != "102" {
+		t.Fatalf("got %s from the other sequence, want 102", id)
+	}
+}
@@ -1,14 +1,17 @@
 package middleware
 
 import (
+	"clase19/internal/domain"
 	"clase19/pkg/web"
 	"errors"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Authentication manages the security by validating the token
+// Authentication manages the security by validating the token.
+// Besides TOKEN, TOKENS can list one token per user as name:token,name:token; the name is recorded as the actor of the changes.
 func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("TOKEN")
@@ -17,11 +20,36 @@ func Authentication() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		if token != os.Getenv("TOKEN") {
+		actor, ok := actorFor(token)
+		if !ok {
 			web.Failure(c, 401, errors.New("invalid token"))
 			c.Abort()
 			return
 		}
+		c.Request = c.Request.WithContext(domain.WithActor(c.Request.Context(), actor))
 		c.Next()
 	}
 }
+
+// actorFor devuelve el usuario de un token de TOKENS, o "token" si es el TOKEN compartido
+func actorFor(token string) (string, bool) {
+	for _, entry := range strings.Split(os.Getenv("TOKENS"), ",") {
+		name, userToken := splitToken(entry)
+		if name != "" && userToken != "" && userToken == token {
+			return name, true
+		}
+	}
+	if shared := os.Getenv("TOKEN"); shared != "" && token == shared {
+		return "token", true
+	}
+	return "", false
+}
+
+// splitToken separa una entrada name:token de TOKENS
+func splitToken(entry string) (string, string) {
+	i := strings.Index(entry, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+}
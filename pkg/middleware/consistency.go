@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"clase19/pkg/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadYourWrites hace que lean de la base primaria, y no de una replica, los requests que escriben y los
+// que traen el header X-Read-Primary: true, para que un cliente vea enseguida lo que acaba de escribir
+func ReadYourWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		primary, _ := strconv.ParseBool(c.GetHeader("X-Read-Primary"))
+		if primary || c.Request.Method != http.MethodGet {
+			c.Request = c.Request.WithContext(store.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS products (
+	id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	quantity INT NOT NULL,
+	code_value VARCHAR(255) NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration DATE NOT NULL,
+	price DECIMAL(12,2) NOT NULL
+);
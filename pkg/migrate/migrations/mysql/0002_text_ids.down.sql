@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS id_sequence;
+ALTER TABLE products MODIFY id INT NOT NULL AUTO_INCREMENT;
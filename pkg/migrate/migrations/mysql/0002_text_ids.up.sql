@@ -0,0 +1,6 @@
+ALTER TABLE products MODIFY id VARCHAR(64) NOT NULL;
+CREATE TABLE IF NOT EXISTS id_sequence (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	value BIGINT NOT NULL
+);
+INSERT INTO id_sequence(name, value) SELECT 'products', COALESCE(MAX(CAST(id AS UNSIGNED)), 0) FROM products;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS product_history (
+	id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	product_id VARCHAR(64) NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	changed_at DATETIME NOT NULL,
+	changes TEXT NOT NULL,
+	INDEX product_history_product (product_id, id)
+);
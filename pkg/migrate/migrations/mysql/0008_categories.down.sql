@@ -0,0 +1,4 @@
+DROP INDEX products_category ON products;
+ALTER TABLE products DROP COLUMN category_id;
+DELETE FROM id_sequence WHERE name = 'categories';
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,3 @@
+DROP INDEX products_parent ON products;
+ALTER TABLE products DROP COLUMN variant;
+ALTER TABLE products DROP COLUMN parent_id;
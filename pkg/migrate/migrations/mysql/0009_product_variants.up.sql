@@ -0,0 +1,3 @@
+ALTER TABLE products ADD COLUMN parent_id VARCHAR(64) NULL;
+ALTER TABLE products ADD COLUMN variant VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX products_parent ON products(parent_id);
@@ -0,0 +1 @@
+ALTER TABLE products DROP FOREIGN KEY products_category_fk;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS products (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	quantity INTEGER NOT NULL,
+	code_value VARCHAR(255) NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration DATE NOT NULL,
+	price NUMERIC(12,2) NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS id_sequence;
+ALTER TABLE products ALTER COLUMN id TYPE INTEGER USING id::integer;
+CREATE SEQUENCE IF NOT EXISTS products_id_seq OWNED BY products.id;
+SELECT setval('products_id_seq', COALESCE((SELECT MAX(id) FROM products), 0) + 1, false);
+ALTER TABLE products ALTER COLUMN id SET DEFAULT nextval('products_id_seq');
@@ -0,0 +1,8 @@
+ALTER TABLE products ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE products ALTER COLUMN id TYPE VARCHAR(64) USING id::text;
+DROP SEQUENCE IF EXISTS products_id_seq;
+CREATE TABLE IF NOT EXISTS id_sequence (
+	name VARCHAR(64) NOT NULL PRIMARY KEY,
+	value BIGINT NOT NULL
+);
+INSERT INTO id_sequence(name, value) SELECT 'products', COALESCE(MAX(id::bigint), 0) FROM products WHERE id ~ '^[0-9]+$';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS product_history (
+	id BIGSERIAL PRIMARY KEY,
+	product_id VARCHAR(64) NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	changed_at TIMESTAMP NOT NULL,
+	changes TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS product_history_product ON product_history (product_id, id);
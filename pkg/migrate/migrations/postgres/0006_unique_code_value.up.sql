@@ -0,0 +1 @@
+CREATE UNIQUE INDEX products_code_value_unique ON products(code_value);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS products_category;
+ALTER TABLE products DROP COLUMN category_id;
+DELETE FROM id_sequence WHERE name = 'categories';
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS products (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	code_value TEXT NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration TEXT NOT NULL,
+	price REAL NOT NULL
+);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS id_sequence;
+CREATE TABLE products_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	code_value TEXT NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration TEXT NOT NULL,
+	price REAL NOT NULL
+);
+INSERT INTO products_old(id, name, quantity, code_value, is_published, expiration, price)
+	SELECT CAST(id AS INTEGER), name, quantity, code_value, is_published, expiration, price FROM products;
+DROP TABLE products;
+ALTER TABLE products_old RENAME TO products;
@@ -0,0 +1,18 @@
+CREATE TABLE products_new (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	code_value TEXT NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration TEXT NOT NULL,
+	price REAL NOT NULL
+);
+INSERT INTO products_new(id, name, quantity, code_value, is_published, expiration, price)
+	SELECT CAST(id AS TEXT), name, quantity, code_value, is_published, expiration, price FROM products;
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+CREATE TABLE IF NOT EXISTS id_sequence (
+	name TEXT NOT NULL PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+INSERT INTO id_sequence(name, value) SELECT 'products', COALESCE(MAX(CAST(id AS INTEGER)), 0) FROM products;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS product_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	product_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL,
+	changes TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS product_history_product ON product_history (product_id, id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS products_code_value_unique;
@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'ARS';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS categories (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	parent_id TEXT NULL
+);
+CREATE INDEX IF NOT EXISTS categories_parent ON categories(parent_id);
+INSERT INTO id_sequence(name, value) VALUES('categories', 0);
+ALTER TABLE products ADD COLUMN category_id TEXT NULL;
+CREATE INDEX IF NOT EXISTS products_category ON products(category_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS products_parent;
+ALTER TABLE products DROP COLUMN variant;
+ALTER TABLE products DROP COLUMN parent_id;
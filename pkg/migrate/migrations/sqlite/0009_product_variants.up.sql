@@ -0,0 +1,3 @@
+ALTER TABLE products ADD COLUMN parent_id TEXT NULL;
+ALTER TABLE products ADD COLUMN variant TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS products_parent ON products(parent_id);
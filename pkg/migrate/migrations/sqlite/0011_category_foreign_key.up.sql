@@ -0,0 +1,23 @@
+CREATE TABLE products_new (
+	id TEXT NOT NULL PRIMARY KEY,
+	name TEXT NOT NULL,
+	quantity INTEGER NOT NULL,
+	code_value TEXT NOT NULL,
+	is_published BOOLEAN NOT NULL DEFAULT FALSE,
+	expiration TEXT NOT NULL,
+	price TEXT NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	deleted_at TIMESTAMP NULL,
+	currency TEXT NOT NULL DEFAULT 'ARS',
+	category_id TEXT NULL REFERENCES categories(id),
+	parent_id TEXT NULL,
+	variant TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO products_new(id, name, quantity, code_value, is_published, expiration, price, version, deleted_at, currency, category_id, parent_id, variant)
+	SELECT id, name, quantity, code_value, is_published, expiration, price, version, deleted_at, currency,
+		CASE WHEN category_id IN (SELECT id FROM categories) THEN category_id END, parent_id, variant FROM products;
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+CREATE UNIQUE INDEX products_code_value_unique ON products(code_value);
+CREATE INDEX IF NOT EXISTS products_category ON products(category_id);
+CREATE INDEX IF NOT EXISTS products_parent ON products(parent_id);
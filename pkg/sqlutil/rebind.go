@@ -0,0 +1,21 @@
+package sqlutil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind reescribe los parametros ? de una consulta como $1, $2..., el formato de postgres
+func Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
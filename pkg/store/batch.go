@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"clase19/internal/domain"
+)
+
+// BatchResult es el resultado de un producto de una operacion en lote: el producto como quedo
+// (solo el id en los borrados) o el error que impidio guardarlo
+type BatchResult struct {
+	Product domain.Product
+	Err     error
+}
+
+// AddEach es el AddMany de los stores que no tienen una escritura en lote: un AddOne por producto, todos en una
+// transaccion de s. Los de codigo repetido se informan en su resultado sin impedir que se guarden los demas
+func AddEach(ctx context.Context, s Store, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return eachItem(ctx, len(products), func(i int) (domain.Product, error) {
+			return tx.AddOne(ctx, products[i])
+		})
+	})
+}
+
+// UpdateEach es el UpdateMany de los stores que no tienen una escritura en lote: un UpdateOne por producto, todos
+// en una transaccion de s, y devuelve como quedaron. Los productos que no existen, tienen una version vieja o un
+// codigo repetido se informan en su resultado sin impedir que se guarden los demas
+func UpdateEach(ctx context.Context, s Store, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return eachItem(ctx, len(products), func(i int) (domain.Product, error) {
+			if err := tx.UpdateOne(ctx, products[i]); err != nil {
+				return domain.Product{Id: products[i].Id}, err
+			}
+			return tx.GetOne(ctx, products[i].Id)
+		})
+	})
+}
+
+// DeleteEach es el DeleteMany de los stores que no tienen un borrado en lote: un DeleteOne por id, todos en una
+// transaccion de s. Los que no existen se informan en su resultado
+func DeleteEach(ctx context.Context, s Store, ids []domain.ID) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return eachItem(ctx, len(ids), func(i int) (domain.Product, error) {
+			return domain.Product{Id: ids[i]}, tx.DeleteOne(ctx, ids[i])
+		})
+	})
+}
+
+// runBatch ejecuta fn en una transaccion de s y devuelve sus resultados
+func runBatch(ctx context.Context, s Store, fn func(tx Store) ([]BatchResult, error)) ([]BatchResult, error) {
+	var results []BatchResult
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		results, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// eachItem ejecuta fn para cada uno de los n elementos. ErrNotFound, ErrVersionConflict y ErrDuplicateCode
+// quedan en el resultado del elemento; cualquier otro error corta el lote y cancela la transaccion
+func eachItem(ctx context.Context, n int, fn func(i int) (domain.Product, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, n)
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		product, err := fn(i)
+		if err != nil && !itemError(err) {
+			return nil, err
+		}
+		results[i] = BatchResult{Product: product, Err: err}
+	}
+	return results, nil
+}
+
+// itemError indica si un error afecta solo a un elemento del lote
+func itemError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) || errors.Is(err, ErrDuplicateCode)
+}
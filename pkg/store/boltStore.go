@@ -0,0 +1,354 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"clase19/internal/domain"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// productsBucket guarda cada producto en json bajo su id; su secuencia es la de los ids
+	productsBucket = []byte("products")
+	// codesBucket indexa los codigos: code_value -> id
+	codesBucket = []byte("codes")
+)
+
+type boltStore struct {
+	db  *bolt.DB
+	gen IDGenerator
+	// tx es la transaccion en curso dentro de WithTx; nil fuera de ella
+	tx *bolt.Tx
+}
+
+// NewBoltStore crea un store sobre el archivo bbolt path. Si el archivo no existe se crea con los productos de
+// seedPath (con el formato de products.json). Si gen es nil los ids salen de la secuencia del bucket de productos.
+// El store implementa io.Closer para liberar el archivo.
+func NewBoltStore(path, seedPath string, gen IDGenerator) (Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(productsBucket) != nil {
+			return nil
+		}
+		for _, name := range [][]byte{productsBucket, codesBucket} {
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return seedBolt(tx, seedPath)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db, gen: gen}, nil
+}
+
+// seedBolt carga en los buckets recien creados los productos del archivo seedPath, si existe
+func seedBolt(tx *bolt.Tx, seedPath string) error {
+	data, err := os.ReadFile(seedPath)
+	if seedPath == "" || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var products []domain.Product
+	if err = json.Unmarshal(data, &products); err != nil {
+		return err
+	}
+	seedVersions(products)
+	for _, product := range products {
+		if err = putBoltProduct(tx, product, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close cierra el archivo
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// view ejecuta fn en la transaccion en curso o en una de solo lectura
+func (s *boltStore) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.db.View(fn)
+}
+
+// update ejecuta fn en la transaccion en curso o en una de escritura, que bbolt confirma en disco al terminar
+func (s *boltStore) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.db.Update(fn)
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *boltStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	return s.Find(ctx, Query{}.OrderBy("id", false))
+}
+
+// GetOne devuelve un producto por su id
+func (s *boltStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	var product domain.Product
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		product, err = getBoltProduct(tx, id, false)
+		return err
+	})
+	return product, err
+}
+
+// Find evalua la consulta; un filtro por igualdad de code_value se resuelve con el indice de codigos
+func (s *boltStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	var products []domain.Product
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		for _, f := range q.Filters {
+			code, ok := f.Value.(string)
+			if f.Field != "code_value" || f.Op != Eq || !ok {
+				continue
+			}
+			products = []domain.Product{}
+			if id := tx.Bucket(codesBucket).Get([]byte(code)); id != nil {
+				product, err := getBoltProduct(tx, domain.ID(id), true)
+				if err != nil {
+					return err
+				}
+				products = append(products, product)
+			}
+			return nil
+		}
+		return tx.Bucket(productsBucket).ForEach(func(k, v []byte) error {
+			var product domain.Product
+			if err := json.Unmarshal(v, &product); err != nil {
+				return err
+			}
+			products = append(products, product)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applyQuery(products, q)
+}
+
+// AddOne agrega un nuevo producto, o devuelve un DuplicateCodeError si su codigo ya esta en uso
+func (s *boltStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		if err := checkBoltCode(tx, product.CodeValue, ""); err != nil {
+			return err
+		}
+		id, err := s.newID(ctx, tx)
+		if err != nil {
+			return err
+		}
+		product.Id = id
+		product.Version = 1
+		product.DeletedAt = nil
+		return putBoltProduct(tx, product, "")
+	})
+	if err != nil {
+		return domain.Product{}, err
+	}
+	return product, nil
+}
+
+// UpdateOne actualiza un producto y mueve su entrada del indice si cambia el codigo
+func (s *boltStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		current, err := getBoltProduct(tx, product.Id, false)
+		if err != nil {
+			return err
+		}
+		if err = checkBoltCode(tx, product.CodeValue, product.Id); err != nil {
+			return err
+		}
+		updated, err := updateProduct(current, product)
+		if err != nil {
+			return err
+		}
+		return putBoltProduct(tx, updated, current.CodeValue)
+	})
+}
+
+// DeleteOne marca un producto como borrado
+func (s *boltStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		product, err := getBoltProduct(tx, id, false)
+		if err != nil {
+			return err
+		}
+		product.DeletedAt = deletedNow()
+		product.Version++
+		return putBoltProduct(tx, product, product.CodeValue)
+	})
+}
+
+// Restore deshace el borrado de un producto
+func (s *boltStore) Restore(ctx context.Context, id domain.ID) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		product, err := getBoltProduct(tx, id, true)
+		if err != nil {
+			return err
+		}
+		if product.DeletedAt == nil {
+			return ErrNotFound
+		}
+		product.DeletedAt = nil
+		product.Version++
+		return putBoltProduct(tx, product, product.CodeValue)
+	})
+}
+
+// Purge elimina los productos borrados antes de before, junto con sus codigos del indice
+func (s *boltStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		var doomed []domain.Product
+		err := tx.Bucket(productsBucket).ForEach(func(k, v []byte) error {
+			var product domain.Product
+			if err := json.Unmarshal(v, &product); err != nil {
+				return err
+			}
+			if purgeable(product, before) {
+				doomed = append(doomed, product)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// bbolt no admite modificar un bucket mientras se lo recorre con ForEach
+		for _, product := range doomed {
+			if err = tx.Bucket(productsBucket).Delete([]byte(product.Id)); err != nil {
+				return err
+			}
+			if product.CodeValue == "" {
+				continue
+			}
+			if err = tx.Bucket(codesBucket).Delete([]byte(product.CodeValue)); err != nil {
+				return err
+			}
+		}
+		purged = len(doomed)
+		return nil
+	})
+	return purged, err
+}
+
+// AddMany agrega los productos en una transaccion de bbolt
+func (s *boltStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return AddEach(ctx, s, products)
+}
+
+// UpdateMany actualiza los productos en una transaccion de bbolt
+func (s *boltStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos en una transaccion de bbolt
+func (s *boltStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx ejecuta fn dentro de una transaccion de escritura de bbolt, que se descarta si fn devuelve error
+func (s *boltStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		return fn(&boltStore{db: s.db, gen: s.gen, tx: tx})
+	})
+}
+
+// newID pide el id al generador, o toma el siguiente valor libre de la secuencia del bucket de productos
+func (s *boltStore) newID(ctx context.Context, tx *bolt.Tx) (domain.ID, error) {
+	if s.gen != nil {
+		return s.gen.NewID(ctx)
+	}
+	bucket := tx.Bucket(productsBucket)
+	for {
+		n, err := bucket.NextSequence()
+		if err != nil {
+			return "", err
+		}
+		id := domain.IntID(int64(n))
+		if bucket.Get([]byte(id)) == nil {
+			return id, nil
+		}
+	}
+}
+
+// getBoltProduct lee un producto; los borrados solo se devuelven si deleted es true
+func getBoltProduct(tx *bolt.Tx, id domain.ID, deleted bool) (domain.Product, error) {
+	data := tx.Bucket(productsBucket).Get([]byte(id))
+	if data == nil {
+		return domain.Product{}, ErrNotFound
+	}
+	var product domain.Product
+	if err := json.Unmarshal(data, &product); err != nil {
+		return domain.Product{}, err
+	}
+	if product.DeletedAt != nil && !deleted {
+		return domain.Product{}, ErrNotFound
+	}
+	return product, nil
+}
+
+// putBoltProduct guarda un producto y su codigo en el indice, quitando oldCode si cambio.
+// Adelanta la secuencia si el id es numerico y mayor, para que las altas siguientes no lo repitan
+func putBoltProduct(tx *bolt.Tx, product domain.Product, oldCode string) error {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	products, codes := tx.Bucket(productsBucket), tx.Bucket(codesBucket)
+	if err = products.Put([]byte(product.Id), data); err != nil {
+		return err
+	}
+	if n, ok := product.Id.Int(); ok && uint64(n) > products.Sequence() {
+		if err = products.SetSequence(uint64(n)); err != nil {
+			return err
+		}
+	}
+	if oldCode != "" && oldCode != product.CodeValue {
+		if err = codes.Delete([]byte(oldCode)); err != nil {
+			return err
+		}
+	}
+	if product.CodeValue == "" {
+		return nil
+	}
+	return codes.Put([]byte(product.CodeValue), []byte(product.Id))
+}
+
+// checkBoltCode devuelve un DuplicateCodeError si el indice asigna el codigo a un producto distinto de except
+func checkBoltCode(tx *bolt.Tx, codeValue string, except domain.ID) error {
+	if codeValue == "" {
+		return nil
+	}
+	owner := tx.Bucket(codesBucket).Get([]byte(codeValue))
+	if owner == nil || domain.ID(owner) == except {
+		return nil
+	}
+	return &DuplicateCodeError{CodeValue: codeValue, ConflictingId: domain.ID(owner)}
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+const defaultCacheSize = 10000
+
+// cacheEntry es un producto cacheado por GetOne
+type cacheEntry struct {
+	id      domain.ID
+	product domain.Product
+	expires time.Time
+}
+
+// flightKey identifica una lectura en curso; incluye la generacion para que una lectura iniciada
+// antes de una escritura no se comparta con las que llegan despues
+type flightKey struct {
+	all        bool
+	id         domain.ID
+	generation uint64
+}
+
+// flight es una lectura a next que comparten todos los pedidos concurrentes de la misma clave
+type flight struct {
+	done     chan struct{}
+	product  domain.Product
+	products []domain.Product
+	err      error
+}
+
+type cachedStore struct {
+	next       Store
+	ttl        time.Duration
+	maxEntries int
+
+	mu         sync.Mutex
+	entries    map[domain.ID]*list.Element
+	lru        *list.List
+	all        []domain.Product
+	allExpires time.Time
+	// generation aumenta con cada escritura; una lectura solo se cachea si no hubo escrituras mientras se hacia
+	generation uint64
+	flights    map[flightKey]*flight
+}
+
+// NewCachedStore envuelve next con un cache de lectura para GetOne y GetAll. Cada entrada vive ttl y se guardan
+// como maximo maxEntries productos (los menos usados salen primero). Las escrituras invalidan lo que modifican.
+// Lo que se cachea se lee de la base primaria: una replica atrasada podria devolver lo que una escritura acaba
+// de invalidar, y quedaria cacheado hasta que venza.
+func NewCachedStore(next Store, ttl time.Duration, maxEntries int) Store {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheSize
+	}
+	return &cachedStore{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[domain.ID]*list.Element{},
+		lru:        list.New(),
+		flights:    map[flightKey]*flight{},
+	}
+}
+
+// GetAll devuelve todos los productos desde el cache o, si vencio, desde next
+func (s *cachedStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	s.mu.Lock()
+	if s.all != nil && time.Now().Before(s.allExpires) {
+		products := copyProducts(s.all)
+		s.mu.Unlock()
+		return products, nil
+	}
+	key := flightKey{all: true, generation: s.generation}
+	f, leader := s.join(key)
+	s.mu.Unlock()
+	if leader {
+		f.products, f.err = s.next.GetAll(WithPrimary(ctx))
+		s.mu.Lock()
+		if f.err == nil && key.generation == s.generation {
+			s.all = copyProducts(f.products)
+			s.allExpires = time.Now().Add(s.ttl)
+		}
+		s.land(key, f)
+		s.mu.Unlock()
+	}
+	if err := s.wait(ctx, f); err != nil {
+		return s.next.GetAll(ctx)
+	}
+	return copyProducts(f.products), nil
+}
+
+// GetOne devuelve un producto desde el cache o, si no esta o vencio, desde next
+func (s *cachedStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	s.mu.Lock()
+	if e, ok := s.entries[id]; ok {
+		entry := e.Value.(*cacheEntry)
+		if time.Now().Before(entry.expires) {
+			s.lru.MoveToFront(e)
+			s.mu.Unlock()
+			return entry.product, nil
+		}
+		s.remove(id)
+	}
+	key := flightKey{id: id, generation: s.generation}
+	f, leader := s.join(key)
+	s.mu.Unlock()
+	if leader {
+		f.product, f.err = s.next.GetOne(WithPrimary(ctx), id)
+		s.mu.Lock()
+		if f.err == nil && key.generation == s.generation {
+			s.put(id, f.product)
+		}
+		s.land(key, f)
+		s.mu.Unlock()
+	}
+	if err := s.wait(ctx, f); err != nil {
+		return s.next.GetOne(ctx, id)
+	}
+	return f.product, f.err
+}
+
+// Find no se cachea: las combinaciones de filtros son demasiadas para invalidarlas con precision
+func (s *cachedStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	return s.next.Find(ctx, q)
+}
+
+// AddOne agrega un producto e invalida la lista completa
+func (s *cachedStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	product, err := s.next.AddOne(ctx, product)
+	s.invalidate(product.Id)
+	return product, err
+}
+
+// UpdateOne actualiza un producto e invalida su entrada y la lista completa
+func (s *cachedStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	err := s.next.UpdateOne(ctx, product)
+	s.invalidate(product.Id)
+	return err
+}
+
+// DeleteOne elimina un producto e invalida su entrada y la lista completa
+func (s *cachedStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	err := s.next.DeleteOne(ctx, id)
+	s.invalidate(id)
+	return err
+}
+
+// Restore deshace el borrado de un producto e invalida la lista completa
+func (s *cachedStore) Restore(ctx context.Context, id domain.ID) error {
+	err := s.next.Restore(ctx, id)
+	s.invalidate(id)
+	return err
+}
+
+// Purge elimina productos borrados, que no estan en el cache de GetOne ni de GetAll
+func (s *cachedStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	return s.next.Purge(ctx, before)
+}
+
+// AddMany agrega los productos con el AddMany de next e invalida la lista completa
+func (s *cachedStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.AddMany(ctx, products)
+	})
+}
+
+// UpdateMany actualiza los productos con el UpdateMany de next e invalida sus entradas
+func (s *cachedStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.UpdateMany(ctx, products)
+	})
+}
+
+// DeleteMany borra los productos con el DeleteMany de next e invalida sus entradas
+func (s *cachedStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.DeleteMany(ctx, ids)
+	})
+}
+
+// WithTx ejecuta fn en una transaccion de next sin pasar por el cache, e invalida los productos que fn modifico
+func (s *cachedStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	var touched []domain.ID
+	err := s.next.WithTx(ctx, func(tx Store) error {
+		return fn(&recordingStore{Store: tx, touched: &touched})
+	})
+	s.invalidate(touched...)
+	return err
+}
+
+// join devuelve la lectura en curso para la clave, o crea una nueva si no hay; leader indica quien debe hacerla.
+// Se llama con mu tomado.
+func (s *cachedStore) join(key flightKey) (f *flight, leader bool) {
+	if f, ok := s.flights[key]; ok {
+		return f, false
+	}
+	f = &flight{done: make(chan struct{})}
+	s.flights[key] = f
+	return f, true
+}
+
+// land marca la lectura como terminada y despierta a los que esperan. Se llama con mu tomado.
+func (s *cachedStore) land(key flightKey, f *flight) {
+	delete(s.flights, key)
+	close(f.done)
+}
+
+// wait espera el resultado de una lectura compartida. Si fallo porque se cancelo el contexto de quien la hizo,
+// pero no el propio, devuelve error para que el llamador lea por su cuenta.
+func (s *cachedStore) wait(ctx context.Context, f *flight) error {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if f.err != nil && (f.err == context.Canceled || f.err == context.DeadlineExceeded) && ctx.Err() == nil {
+		return f.err
+	}
+	return nil
+}
+
+// put guarda un producto en el cache, descartando el menos usado si se supera el maximo. Se llama con mu tomado.
+func (s *cachedStore) put(id domain.ID, product domain.Product) {
+	if e, ok := s.entries[id]; ok {
+		s.lru.Remove(e)
+	}
+	s.entries[id] = s.lru.PushFront(&cacheEntry{id: id, product: product, expires: time.Now().Add(s.ttl)})
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back().Value.(*cacheEntry).id)
+	}
+}
+
+// remove quita un producto del cache. Se llama con mu tomado.
+func (s *cachedStore) remove(id domain.ID) {
+	if e, ok := s.entries[id]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, id)
+	}
+}
+
+// invalidate quita los productos indicados y la lista completa, y descarta las lecturas en curso
+func (s *cachedStore) invalidate(ids ...domain.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.all = nil
+	for _, id := range ids {
+		s.remove(id)
+	}
+}
+
+// recordingStore anota los ids que se modifican dentro de una transaccion
+type recordingStore struct {
+	Store
+	touched *[]domain.ID
+}
+
+// AddOne agrega un producto y anota su id
+func (s *recordingStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	product, err := s.Store.AddOne(ctx, product)
+	*s.touched = append(*s.touched, product.Id)
+	return product, err
+}
+
+// UpdateOne actualiza un producto y anota su id
+func (s *recordingStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	*s.touched = append(*s.touched, product.Id)
+	return s.Store.UpdateOne(ctx, product)
+}
+
+// DeleteOne elimina un producto y anota su id
+func (s *recordingStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	*s.touched = append(*s.touched, id)
+	return s.Store.DeleteOne(ctx, id)
+}
+
+// Restore deshace el borrado de un producto y anota su id
+func (s *recordingStore) Restore(ctx context.Context, id domain.ID) error {
+	*s.touched = append(*s.touched, id)
+	return s.Store.Restore(ctx, id)
+}
+
+// AddMany agrega los productos y anota sus ids
+func (s *recordingStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	results, err := s.Store.AddMany(ctx, products)
+	for _, result := range results {
+		*s.touched = append(*s.touched, result.Product.Id)
+	}
+	return results, err
+}
+
+// UpdateMany actualiza los productos y anota sus ids
+func (s *recordingStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	for _, product := range products {
+		*s.touched = append(*s.touched, product.Id)
+	}
+	return s.Store.UpdateMany(ctx, products)
+}
+
+// DeleteMany borra los productos y anota sus ids
+func (s *recordingStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	*s.touched = append(*s.touched, ids...)
+	return s.Store.DeleteMany(ctx, ids)
+}
+
+// WithTx mantiene el registro en las transacciones anidadas
+func (s *recordingStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.Store.WithTx(ctx, func(tx Store) error {
+		return fn(&recordingStore{Store: tx, touched: s.touched})
+	})
+}
+
+// copyProducts copia una lista para que quien la recibe no modifique el cache
+func copyProducts(products []domain.Product) []domain.Product {
+	out := make([]domain.Product, len(products))
+	copy(out, products)
+	return out
+}
@@ -0,0 +1,85 @@
+package store_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+// countingStore cuenta las lecturas de GetOne que llegan al store y las retiene hasta que se abra gate
+type countingStore struct {
+	store.Store
+	gets int32
+	gate chan struct{}
+}
+
+func (s *countingStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	atomic.AddInt32(&s.gets, 1)
+	<-s.gate
+	return s.Store.GetOne(ctx, id)
+}
+
+// TestCachedStoreSharesMisses comprueba que los pedidos concurrentes de un id que no esta en el cache hagan
+// una sola lectura, y que despues de UpdateOne se vuelva a leer el producto actualizado
+func TestCachedStoreSharesMisses(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Store: store.NewMemoryStore(nil, nil), gate: make(chan struct{})}
+	added, err := backend.AddOne(ctx, domain.Product{Name: "cached", Quantity: 1, CodeValue: "CACHE1", Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(100, domain.DefaultCurrency)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := store.NewCachedStore(backend, time.Minute, 0)
+
+	const readers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := cached.GetOne(ctx, added.Id)
+			if err == nil && p.Name != "cached" {
+				t.Errorf("got name %q, want cached", p.Name)
+			}
+			errs <- err
+		}()
+	}
+	// da tiempo a que todos los pedidos se sumen a la lectura en curso antes de dejarla terminar
+	time.Sleep(50 * time.Millisecond)
+	close(backend.gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gets := atomic.LoadInt32(&backend.gets); gets != 1 {
+		t.Fatalf("%d concurrent misses made %d reads, want 1", readers, gets)
+	}
+
+	if _, err = cached.GetOne(ctx, added.Id); err != nil {
+		t.Fatal(err)
+	}
+	if gets := atomic.LoadInt32(&backend.gets); gets != 1 {
+		t.Fatalf("cached read reached the store, %d reads", gets)
+	}
+	if err = cached.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := cached.GetOne(ctx, added.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "updated" {
+		t.Fatalf("got name %q after update, want updated", p.Name)
+	}
+	if gets := atomic.LoadInt32(&backend.gets); gets != 2 {
+		t.Fatalf("read after update made %d reads in total, want 2", gets)
+	}
+}
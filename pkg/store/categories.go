@@ -0,0 +1,390 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+
+	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
+)
+
+// ErrCategoryNotFound lo devuelven los CategoryStore cuando la categoria pedida no existe, y el store sql de
+// productos cuando un producto pasaria a usar una categoria que no existe
+var ErrCategoryNotFound = errors.New("category not found")
+
+// ErrCategoryInUse lo devuelve el store sql de categorias al borrar una categoria que usa algun producto
+var ErrCategoryInUse = errors.New("category is used by products")
+
+// CategoryStore guarda las categorias de productos. No controla la jerarquia: eso lo hace el servicio de categorias
+type CategoryStore interface {
+	// List devuelve todas las categorias ordenadas por id
+	List(ctx context.Context) ([]domain.Category, error)
+	Get(ctx context.Context, id domain.ID) (domain.Category, error)
+	// Add guarda la categoria con un id nuevo
+	Add(ctx context.Context, category domain.Category) (domain.Category, error)
+	// Update reemplaza el nombre y la categoria padre
+	Update(ctx context.Context, category domain.Category) error
+	Delete(ctx context.Context, id domain.ID) error
+	// WithTx ejecuta fn como una unidad de trabajo aislada de las demas escrituras de categorias: lo que fn lee
+	// sigue valiendo cuando escribe, y si devuelve error no se aplica ningun cambio
+	WithTx(ctx context.Context, fn func(tx CategoryStore) error) error
+}
+
+type memoryCategories struct {
+	mu         sync.RWMutex
+	categories []domain.Category
+}
+
+// NewMemoryCategories crea un store de categorias en memoria, para el store memory
+func NewMemoryCategories() CategoryStore {
+	return &memoryCategories{}
+}
+
+// List devuelve todas las categorias
+func (s *memoryCategories) List(ctx context.Context) ([]domain.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]domain.Category{}, s.categories...), nil
+}
+
+// Get devuelve una categoria por su id
+func (s *memoryCategories) Get(ctx context.Context, id domain.ID) (domain.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return getCategory(s.categories, id)
+}
+
+// Add agrega una categoria
+func (s *memoryCategories) Add(ctx context.Context, category domain.Category) (domain.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories, category = addCategory(s.categories, category)
+	return category, nil
+}
+
+// Update modifica una categoria
+func (s *memoryCategories) Update(ctx context.Context, category domain.Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return updateCategory(s.categories, category)
+}
+
+// Delete elimina una categoria
+func (s *memoryCategories) Delete(ctx context.Context, id domain.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	s.categories, err = deleteCategory(s.categories, id)
+	return err
+}
+
+// WithTx ejecuta fn sobre una copia de las categorias, con el store bloqueado, y la aplica si no hubo error
+func (s *memoryCategories) WithTx(ctx context.Context, fn func(tx CategoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &memoryCategories{categories: append([]domain.Category{}, s.categories...)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.categories = tx.categories
+	return nil
+}
+
+type fileCategories struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCategories crea un store de categorias en el archivo json path, para los stores json, journal, events y bolt.
+// El archivo se crea con la primera categoria
+func NewFileCategories(path string) CategoryStore {
+	return &fileCategories{path: path}
+}
+
+// load lee las categorias con el archivo bloqueado; un archivo inexistente no tiene categorias
+func (s *fileCategories) load(ctx context.Context) ([]domain.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []domain.Category{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var categories []domain.Category
+	if err = json.Unmarshal(data, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// read ejecuta fn sobre las categorias del archivo con un bloqueo compartido
+func (s *fileCategories) read(ctx context.Context, fn func(categories []domain.Category) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := fileutil.Lock(s.path+".lock", false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	categories, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(categories)
+}
+
+// write ejecuta fn sobre las categorias del archivo con un bloqueo exclusivo y guarda lo que devuelve si no hubo error
+func (s *fileCategories) write(ctx context.Context, fn func(categories []domain.Category) ([]domain.Category, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := fileutil.Lock(s.path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	categories, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	if categories, err = fn(categories); err != nil {
+		return err
+	}
+	data, err := json.Marshal(categories)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(s.path, data, 0644)
+}
+
+// List devuelve todas las categorias
+func (s *fileCategories) List(ctx context.Context) ([]domain.Category, error) {
+	var list []domain.Category
+	err := s.read(ctx, func(categories []domain.Category) error {
+		list = categories
+		return nil
+	})
+	return list, err
+}
+
+// Get devuelve una categoria por su id
+func (s *fileCategories) Get(ctx context.Context, id domain.ID) (domain.Category, error) {
+	var category domain.Category
+	err := s.read(ctx, func(categories []domain.Category) error {
+		var err error
+		category, err = getCategory(categories, id)
+		return err
+	})
+	return category, err
+}
+
+// Add agrega una categoria al archivo
+func (s *fileCategories) Add(ctx context.Context, category domain.Category) (domain.Category, error) {
+	err := s.write(ctx, func(categories []domain.Category) ([]domain.Category, error) {
+		categories, category = addCategory(categories, category)
+		return categories, nil
+	})
+	if err != nil {
+		return domain.Category{}, err
+	}
+	return category, nil
+}
+
+// Update modifica una categoria del archivo
+func (s *fileCategories) Update(ctx context.Context, category domain.Category) error {
+	return s.write(ctx, func(categories []domain.Category) ([]domain.Category, error) {
+		return categories, updateCategory(categories, category)
+	})
+}
+
+// Delete elimina una categoria del archivo
+func (s *fileCategories) Delete(ctx context.Context, id domain.ID) error {
+	return s.write(ctx, func(categories []domain.Category) ([]domain.Category, error) {
+		return deleteCategory(categories, id)
+	})
+}
+
+// WithTx ejecuta fn sobre las categorias del archivo en memoria, con el bloqueo exclusivo tomado, y guarda el resultado
+func (s *fileCategories) WithTx(ctx context.Context, fn func(tx CategoryStore) error) error {
+	return s.write(ctx, func(categories []domain.Category) ([]domain.Category, error) {
+		tx := &memoryCategories{categories: categories}
+		err := fn(tx)
+		return tx.categories, err
+	})
+}
+
+type sqlCategories struct {
+	db      *sql.DB
+	dialect Dialect
+	// q es la conexion o la transaccion en curso
+	q querier
+}
+
+// NewSqlCategories crea un store de categorias en la tabla categories (creada por la migracion 0008)
+func NewSqlCategories(db *sql.DB, dialect Dialect) CategoryStore {
+	return &sqlCategories{db: db, dialect: dialect, q: db}
+}
+
+// List devuelve todas las categorias
+func (s *sqlCategories) List(ctx context.Context) ([]domain.Category, error) {
+	rows, err := s.q.QueryContext(ctx, "SELECT id, name, parent_id FROM categories")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := []domain.Category{}
+	for rows.Next() {
+		var category domain.Category
+		if err = rows.Scan(&category.Id, &category.Name, idColumn{&category.ParentId}); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sortCategories(categories)
+	return categories, nil
+}
+
+// Get devuelve una categoria por su id
+func (s *sqlCategories) Get(ctx context.Context, id domain.ID) (domain.Category, error) {
+	var category domain.Category
+	query := s.dialect.rebind("SELECT id, name, parent_id FROM categories WHERE id = ?")
+	err := s.q.QueryRowContext(ctx, query, id).Scan(&category.Id, &category.Name, idColumn{&category.ParentId})
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Category{}, ErrCategoryNotFound
+	}
+	return category, err
+}
+
+// Add inserta la categoria con el siguiente valor de la secuencia categories, en la misma transaccion
+func (s *sqlCategories) Add(ctx context.Context, category domain.Category) (domain.Category, error) {
+	err := s.WithTx(ctx, func(tx CategoryStore) error {
+		t := tx.(*sqlCategories)
+		value, err := nextSequence(ctx, t.q, t.dialect, "categories", 1)
+		if err != nil {
+			return err
+		}
+		category.Id = domain.IntID(value)
+		query := t.dialect.rebind("INSERT INTO categories(id, name, parent_id) VALUES(?, ?, ?)")
+		_, err = t.q.ExecContext(ctx, query, category.Id, category.Name, nullID(category.ParentId))
+		return err
+	})
+	if err != nil {
+		return domain.Category{}, err
+	}
+	return category, nil
+}
+
+// Update modifica una categoria
+func (s *sqlCategories) Update(ctx context.Context, category domain.Category) error {
+	query := s.dialect.rebind("UPDATE categories SET name = ?, parent_id = ? WHERE id = ?")
+	result, err := s.q.ExecContext(ctx, query, category.Name, nullID(category.ParentId), category.Id)
+	if err != nil {
+		return err
+	}
+	return categoryAffected(result)
+}
+
+// Delete elimina una categoria. La clave foranea de products.category_id (migraciones 0010 y, en sqlite, 0011)
+// impide borrarla si la usa algun producto, incluso uno que la tomo despues de que el servicio lo controlara
+func (s *sqlCategories) Delete(ctx context.Context, id domain.ID) error {
+	result, err := s.q.ExecContext(ctx, s.dialect.rebind("DELETE FROM categories WHERE id = ?"), id)
+	if isForeignKey(err) {
+		return ErrCategoryInUse
+	}
+	if err != nil {
+		return err
+	}
+	return categoryAffected(result)
+}
+
+// WithTx ejecuta fn en una transaccion de la base. Primero bloquea la fila categories de id_sequence, asi las
+// transacciones de categorias se ejecutan de a una en los tres motores
+func (s *sqlCategories) WithTx(ctx context.Context, fn func(tx CategoryStore) error) error {
+	if _, ok := s.q.(*sql.Tx); ok {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, s.dialect.rebind("UPDATE id_sequence SET value = value WHERE name = ?"), "categories"); err != nil {
+		return err
+	}
+	if err = fn(&sqlCategories{db: s.db, dialect: s.dialect, q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// categoryAffected devuelve ErrCategoryNotFound si la sentencia no modifico ninguna fila
+func categoryAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// getCategory busca una categoria en la lista
+func getCategory(categories []domain.Category, id domain.ID) (domain.Category, error) {
+	for _, category := range categories {
+		if category.Id == id {
+			return category, nil
+		}
+	}
+	return domain.Category{}, ErrCategoryNotFound
+}
+
+// addCategory agrega la categoria con el id siguiente al mayor id de la lista
+func addCategory(categories []domain.Category, category domain.Category) ([]domain.Category, domain.Category) {
+	var max int64
+	for _, c := range categories {
+		if n, ok := c.Id.Int(); ok && n > max {
+			max = n
+		}
+	}
+	category.Id = domain.IntID(max + 1)
+	return append(categories, category), category
+}
+
+// updateCategory reemplaza la categoria con el mismo id
+func updateCategory(categories []domain.Category, category domain.Category) error {
+	for i := range categories {
+		if categories[i].Id == category.Id {
+			categories[i] = category
+			return nil
+		}
+	}
+	return ErrCategoryNotFound
+}
+
+// deleteCategory quita la categoria de la lista
+func deleteCategory(categories []domain.Category, id domain.ID) ([]domain.Category, error) {
+	for i := range categories {
+		if categories[i].Id == id {
+			return append(categories[:i], categories[i+1:]...), nil
+		}
+	}
+	return nil, ErrCategoryNotFound
+}
+
+// sortCategories ordena las categorias por id
+func sortCategories(categories []domain.Category) {
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Id.Less(categories[j].Id)
+	})
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"clase19/pkg/sqlutil"
+)
+
+// Dialect describe las diferencias de SQL entre los motores soportados por sqlStore
+type Dialect struct {
+	Name   string
+	Driver string
+	// numbered indica si los parametros se escriben $1, $2... en lugar de ?
+	numbered bool
+	// textPrice indica si price se guarda como texto, en sqlite que no tiene un tipo decimal exacto
+	textPrice bool
+	// rowLocks indica si el motor bloquea filas con SELECT ... FOR UPDATE; sqlite bloquea la base entera
+	rowLocks bool
+}
+
+var (
+	MySQL    = Dialect{Name: "mysql", Driver: "mysql", rowLocks: true}
+	Postgres = Dialect{Name: "postgres", Driver: "postgres", numbered: true, rowLocks: true}
+	SQLite   = Dialect{Name: "sqlite", Driver: "sqlite3", textPrice: true}
+)
+
+// ParseDSN elige el dialecto segun el esquema del DSN y devuelve el DSN que entiende su driver.
+// postgres:// y postgresql:// usan Postgres, sqlite:// usa SQLite y el resto (con o sin mysql://) usa MySQL.
+func ParseDSN(dsn string) (Dialect, string, error) {
+	if dsn == "" {
+		return Dialect{}, "", errors.New("empty dsn")
+	}
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return Postgres, dsn, nil
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return SQLite, strings.TrimPrefix(dsn, "sqlite://"), nil
+	case strings.HasPrefix(dsn, "mysql://"):
+		return MySQL, strings.TrimPrefix(dsn, "mysql://"), nil
+	}
+	return MySQL, dsn, nil
+}
+
+// rebind reescribe los parametros ? de una consulta al formato del dialecto
+func (d Dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	return sqlutil.Rebind(query)
+}
+
+// compared devuelve la expresion con la que se filtra y ordena por expr, una columna o un parametro del campo
+// field. Un price guardado como texto se compara como numero
+func (d Dialect) compared(field, expr string) string {
+	if field == "price" && d.textPrice {
+		return "CAST(" + expr + " AS REAL)"
+	}
+	return expr
+}
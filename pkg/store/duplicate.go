@@ -0,0 +1,67 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"clase19/internal/domain"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// DuplicateCodeError es el error concreto de un codigo repetido, con el producto que ya lo usa.
+// errors.Is(err, ErrDuplicateCode) es true para este error
+type DuplicateCodeError struct {
+	CodeValue     string
+	ConflictingId domain.ID
+}
+
+func (e *DuplicateCodeError) Error() string {
+	return fmt.Sprintf("code value %s already exists in product %s", e.CodeValue, e.ConflictingId)
+}
+
+// Is hace que el error coincida con ErrDuplicateCode
+func (e *DuplicateCodeError) Is(target error) bool {
+	return target == ErrDuplicateCode
+}
+
+// checkCode devuelve un DuplicateCodeError si otro producto distinto de except, borrado o no, usa el codigo.
+// Un codigo vacio no se controla: en las actualizaciones significa que no cambia
+func checkCode(products []domain.Product, codeValue string, except domain.ID) error {
+	if codeValue == "" {
+		return nil
+	}
+	for _, p := range products {
+		if p.CodeValue == codeValue && p.Id != except {
+			return &DuplicateCodeError{CodeValue: codeValue, ConflictingId: p.Id}
+		}
+	}
+	return nil
+}
+
+// isDuplicateCode indica si err es la violacion del indice unico de code_value:
+// el error 1062 de mysql, el 23505 de postgres o la restriccion UNIQUE de sqlite
+func isDuplicateCode(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	duplicate := (errors.As(err, &mysqlErr) && mysqlErr.Number == 1062) ||
+		(errors.As(err, &pqErr) && pqErr.Code == "23505") ||
+		(errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+	// el nombre del indice o de la columna distingue el codigo de otras claves unicas, como el id
+	return duplicate && strings.Contains(err.Error(), "code_value")
+}
+
+// isForeignKey indica si err es la violacion de la clave foranea de products.category_id: los errores 1451 y 1452
+// de mysql, el 23503 de postgres o la restriccion FOREIGN KEY de sqlite
+func isForeignKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pqErr *pq.Error
+	var sqliteErr sqlite3.Error
+	return (errors.As(err, &mysqlErr) && (mysqlErr.Number == 1451 || mysqlErr.Number == 1452)) ||
+		(errors.As(err, &pqErr) && pqErr.Code == "23503") ||
+		(errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey)
+}
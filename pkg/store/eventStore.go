@@ -0,0 +1,520 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
+)
+
+// Tipos de eventos del log
+const (
+	EventProductCreated = "ProductCreated"
+	EventDetailsChanged = "DetailsChanged"
+	EventPriceChanged   = "PriceChanged"
+	EventStockAdjusted  = "StockAdjusted"
+	EventPublished      = "Published"
+	EventUnpublished    = "Unpublished"
+	EventDeleted        = "Deleted"
+	EventRestored       = "Restored"
+	EventPurged         = "Purged"
+)
+
+const defaultProjectionEvery = 1000
+
+// Event es un cambio inmutable sobre un producto. Solo se completan los campos de su tipo:
+// Product en ProductCreated, Name/CodeValue/Expiration/CategoryId/Variant en DetailsChanged, Price en PriceChanged,
+// Delta en StockAdjusted y DeletedAt en Deleted. Version es la version del producto despues del evento.
+type Event struct {
+	Type       string          `json:"type"`
+	ProductId  domain.ID       `json:"product_id"`
+	Version    int             `json:"version"`
+	Product    *domain.Product `json:"product,omitempty"`
+	Name       *string         `json:"name,omitempty"`
+	CodeValue  *string         `json:"code_value,omitempty"`
+	Expiration *domain.Date    `json:"expiration,omitempty"`
+	CategoryId *domain.ID      `json:"category_id,omitempty"`
+	Variant    *string         `json:"variant,omitempty"`
+	Price      *domain.Money   `json:"price,omitempty"`
+	Delta      *int            `json:"delta,omitempty"`
+	DeletedAt  *time.Time      `json:"deleted_at,omitempty"`
+}
+
+// eventCommit es una linea del log: los eventos de una misma operacion, que se aplican todos o ninguno
+type eventCommit struct {
+	Seq    int64     `json:"seq"`
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"`
+	Events []Event   `json:"events"`
+}
+
+// projection es el estado de los productos despues de aplicar los commits hasta Seq, guardado para no
+// reproducir todo el log en cada arranque
+type projection struct {
+	Seq      int64            `json:"seq"`
+	Products []domain.Product `json:"products"`
+}
+
+type eventStore struct {
+	mu              sync.RWMutex
+	logPath         string
+	projectionPath  string
+	log             *os.File
+	seq             int64
+	products        map[domain.ID]domain.Product
+	gen             IDGenerator
+	commits         int
+	projectionEvery int
+}
+
+// NewEventStore crea un store que guarda cada cambio como eventos en el log logPath y mantiene el estado actual
+// como una proyeccion en memoria, persistida en logPath.projection cada projectionEvery commits.
+// Si el log no existe se inicia con un ProductCreated por cada producto de seedPath (con el formato de products.json).
+func NewEventStore(logPath, seedPath string, projectionEvery int, gen IDGenerator) (Store, error) {
+	if projectionEvery <= 0 {
+		projectionEvery = defaultProjectionEvery
+	}
+	s := &eventStore{
+		logPath:         logPath,
+		projectionPath:  logPath + ".projection",
+		products:        map[domain.ID]domain.Product{},
+		gen:             defaultGenerator(gen),
+		projectionEvery: projectionEvery,
+	}
+	if _, err := os.Stat(logPath); errors.Is(err, os.ErrNotExist) {
+		if err = seedEventLog(logPath, seedPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.loadProjection(); err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.log = file
+	return s, nil
+}
+
+// RebuildProjection descarta la proyeccion guardada, reproduce todo el log y guarda la nueva proyeccion.
+// Devuelve la cantidad de eventos aplicados.
+func RebuildProjection(logPath string) (int, error) {
+	s := &eventStore{
+		logPath:        logPath,
+		projectionPath: logPath + ".projection",
+		products:       map[domain.ID]domain.Product{},
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	events := 0
+	_, err = readCommits(file, func(commit eventCommit) error {
+		if err := s.apply(commit); err != nil {
+			return err
+		}
+		events += len(commit.Events)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return events, s.saveProjection()
+}
+
+// seedEventLog crea el log con un ProductCreated por cada producto del archivo seedPath, si existe
+func seedEventLog(logPath, seedPath string) error {
+	var commit eventCommit
+	data, err := os.ReadFile(seedPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var products []domain.Product
+		if err = json.Unmarshal(data, &products); err != nil {
+			return err
+		}
+		commit = eventCommit{Seq: 1, At: time.Now().UTC(), Actor: "seed"}
+		seedVersions(products)
+		for i := range products {
+			commit.Events = append(commit.Events, Event{Type: EventProductCreated, ProductId: products[i].Id, Version: products[i].Version, Product: &products[i]})
+		}
+	}
+	var content []byte
+	if len(commit.Events) > 0 {
+		line, err := json.Marshal(commit)
+		if err != nil {
+			return err
+		}
+		content = append(line, '\n')
+	}
+	return fileutil.WriteAtomic(logPath, content, 0644)
+}
+
+// loadProjection carga la proyeccion guardada si existe
+func (s *eventStore) loadProjection() error {
+	data, err := os.ReadFile(s.projectionPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var p projection
+	if err = json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("invalid projection %s, rebuild it: %w", s.projectionPath, err)
+	}
+	s.seq = p.Seq
+	for _, product := range p.Products {
+		s.products[product.Id] = product
+	}
+	observeIDs(s.gen, p.Products)
+	return nil
+}
+
+// replay aplica los commits posteriores a la proyeccion. Una ultima linea incompleta, producto de una caida
+// a mitad de escritura, se descarta y se trunca el archivo.
+func (s *eventStore) replay() error {
+	file, err := os.OpenFile(s.logPath, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset, err := readCommits(file, func(commit eventCommit) error {
+		if commit.Seq <= s.seq {
+			return nil
+		}
+		return s.apply(commit)
+	})
+	if err != nil {
+		return err
+	}
+	return file.Truncate(offset)
+}
+
+// readCommits lee el log llamando a fn con cada commit completo, y devuelve hasta donde el log es valido
+func readCommits(r io.Reader, fn func(commit eventCommit) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			offset += int64(len(line))
+			continue
+		}
+		var commit eventCommit
+		if err = json.Unmarshal(line, &commit); err != nil {
+			return offset, nil
+		}
+		if err = fn(commit); err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+	}
+}
+
+// apply aplica los eventos de un commit sobre la proyeccion
+func (s *eventStore) apply(commit eventCommit) error {
+	for _, e := range commit.Events {
+		p, exists := s.products[e.ProductId]
+		if e.Type != EventProductCreated && !exists {
+			return fmt.Errorf("event %s of commit %d for unknown product %s", e.Type, commit.Seq, e.ProductId)
+		}
+		switch e.Type {
+		case EventProductCreated:
+			p = *e.Product
+		case EventDetailsChanged:
+			if e.Name != nil {
+				p.Name = *e.Name
+			}
+			if e.CodeValue != nil {
+				p.CodeValue = *e.CodeValue
+			}
+			if e.Expiration != nil {
+				p.Expiration = *e.Expiration
+			}
+			if e.CategoryId != nil {
+				p.CategoryId = *e.CategoryId
+			}
+			if e.Variant != nil {
+				p.Variant = *e.Variant
+			}
+		case EventPriceChanged:
+			p.Price = *e.Price
+		case EventStockAdjusted:
+			p.Quantity += *e.Delta
+		case EventPublished:
+			p.IsPublished = true
+		case EventUnpublished:
+			p.IsPublished = false
+		case EventDeleted:
+			p.DeletedAt = e.DeletedAt
+		case EventRestored:
+			p.DeletedAt = nil
+		case EventPurged:
+			delete(s.products, e.ProductId)
+			continue
+		default:
+			return fmt.Errorf("unknown event %s in commit %d", e.Type, commit.Seq)
+		}
+		p.Version = e.Version
+		s.products[e.ProductId] = p
+		if s.gen != nil {
+			observeIDs(s.gen, []domain.Product{p})
+		}
+	}
+	s.seq = commit.Seq
+	return nil
+}
+
+// write agrega los eventos al log como un commit, sincroniza a disco y recien entonces los aplica
+func (s *eventStore) write(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	commit := eventCommit{Seq: s.seq + 1, At: time.Now().UTC(), Actor: domain.ActorFrom(ctx), Events: events}
+	line, err := json.Marshal(commit)
+	if err != nil {
+		return err
+	}
+	info, err := s.log.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = s.log.Write(append(line, '\n')); err != nil {
+		s.log.Truncate(info.Size())
+		return err
+	}
+	if err = s.log.Sync(); err != nil {
+		s.log.Truncate(info.Size())
+		return err
+	}
+	if err = s.apply(commit); err != nil {
+		return err
+	}
+	s.commits++
+	if s.commits >= s.projectionEvery {
+		// los eventos ya quedaron en el log, si falla se reintenta en el proximo commit
+		if err = s.saveProjection(); err != nil {
+			log.Printf("saving event projection failed: %v", err)
+		} else {
+			s.commits = 0
+		}
+	}
+	return nil
+}
+
+// saveProjection guarda la proyeccion actual
+func (s *eventStore) saveProjection() error {
+	data, err := json.Marshal(projection{Seq: s.seq, Products: s.sorted()})
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(s.projectionPath, data, 0644)
+}
+
+// sorted devuelve todos los productos de la proyeccion, borrados incluidos, ordenados por id
+func (s *eventStore) sorted() []domain.Product {
+	products := make([]domain.Product, 0, len(s.products))
+	for _, p := range s.products {
+		products = append(products, p)
+	}
+	products, _ = applyQuery(products, Query{IncludeDeleted: true}.OrderBy("id", false))
+	return products
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *eventStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	return s.Find(ctx, Query{}.OrderBy("id", false))
+}
+
+// GetOne devuelve un producto por su id
+func (s *eventStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	product, ok := s.products[id]
+	if !ok || product.DeletedAt != nil {
+		return domain.Product{}, ErrNotFound
+	}
+	return product, nil
+}
+
+// Find evalua la consulta sobre la proyeccion
+func (s *eventStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return applyQuery(s.sorted(), q)
+}
+
+// AddOne agrega un producto con un evento ProductCreated
+func (s *eventStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	var added domain.Product
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		added, err = tx.AddOne(ctx, product)
+		return err
+	})
+	return added, err
+}
+
+// UpdateOne actualiza un producto con un evento por cada aspecto que cambia
+func (s *eventStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return tx.UpdateOne(ctx, product)
+	})
+}
+
+// DeleteOne borra un producto con un evento Deleted
+func (s *eventStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return tx.DeleteOne(ctx, id)
+	})
+}
+
+// Restore restaura un producto con un evento Restored
+func (s *eventStore) Restore(ctx context.Context, id domain.ID) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return tx.Restore(ctx, id)
+	})
+}
+
+// Purge elimina los productos borrados antes de before con eventos Purged
+func (s *eventStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		purged, err = tx.Purge(ctx, before)
+		return err
+	})
+	return purged, err
+}
+
+// AddMany agrega los productos con los eventos de un mismo commit
+func (s *eventStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return AddEach(ctx, s, products)
+}
+
+// UpdateMany actualiza los productos con los eventos de un mismo commit
+func (s *eventStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos con los eventos de un mismo commit
+func (s *eventStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx ejecuta fn sobre una copia en memoria y guarda sus cambios como eventos de un mismo commit
+func (s *eventStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := NewMemoryStore(s.sorted(), s.gen).(*memoryStore)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return s.write(ctx, s.events(tx.products))
+}
+
+// events deriva los eventos que llevan la proyeccion actual a la lista de productos dada
+func (s *eventStore) events(products []domain.Product) []Event {
+	var events []Event
+	seen := map[domain.ID]bool{}
+	for i, p := range products {
+		seen[p.Id] = true
+		current, ok := s.products[p.Id]
+		if !ok {
+			events = append(events, Event{Type: EventProductCreated, ProductId: p.Id, Version: p.Version, Product: &products[i]})
+			continue
+		}
+		if current == p {
+			continue
+		}
+		events = append(events, changeEvents(current, products[i])...)
+	}
+	for _, p := range s.sorted() {
+		if !seen[p.Id] {
+			events = append(events, Event{Type: EventPurged, ProductId: p.Id, Version: p.Version})
+		}
+	}
+	return events
+}
+
+// changeEvents describe con eventos la diferencia entre dos estados de un producto, incluida la de version
+func changeEvents(current, updated domain.Product) []Event {
+	var events []Event
+	id, version := updated.Id, updated.Version
+	details := Event{Type: EventDetailsChanged, ProductId: id, Version: version}
+	if current.Name != updated.Name {
+		details.Name = &updated.Name
+	}
+	if current.CodeValue != updated.CodeValue {
+		details.CodeValue = &updated.CodeValue
+	}
+	if current.Expiration != updated.Expiration {
+		details.Expiration = &updated.Expiration
+	}
+	if current.CategoryId != updated.CategoryId {
+		details.CategoryId = &updated.CategoryId
+	}
+	if current.Variant != updated.Variant {
+		details.Variant = &updated.Variant
+	}
+	if details.Name != nil || details.CodeValue != nil || details.Expiration != nil || details.CategoryId != nil || details.Variant != nil {
+		events = append(events, details)
+	}
+	if current.Price != updated.Price {
+		events = append(events, Event{Type: EventPriceChanged, ProductId: id, Version: version, Price: &updated.Price})
+	}
+	if current.Quantity != updated.Quantity {
+		delta := updated.Quantity - current.Quantity
+		events = append(events, Event{Type: EventStockAdjusted, ProductId: id, Version: version, Delta: &delta})
+	}
+	if current.IsPublished != updated.IsPublished {
+		kind := EventUnpublished
+		if updated.IsPublished {
+			kind = EventPublished
+		}
+		events = append(events, Event{Type: kind, ProductId: id, Version: version})
+	}
+	switch {
+	case current.DeletedAt == nil && updated.DeletedAt != nil:
+		events = append(events, Event{Type: EventDeleted, ProductId: id, Version: version, DeletedAt: updated.DeletedAt})
+	case current.DeletedAt != nil && updated.DeletedAt == nil:
+		events = append(events, Event{Type: EventRestored, ProductId: id, Version: version})
+	}
+	// una actualizacion sin cambios igual avanza la version: se registra con un DetailsChanged vacio
+	if len(events) == 0 && current.Version != version {
+		events = append(events, details)
+	}
+	return events
+}
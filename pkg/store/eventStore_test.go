@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+// TestRebuildProjection comprueba que la proyeccion reconstruida desde el log tenga el mismo estado que el store
+func TestRebuildProjection(t *testing.T) {
+	ctx := context.Background()
+	logPath := filepath.Join(t.TempDir(), "products.events")
+	s, err := NewEventStore(logPath, "", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := domain.Product{Quantity: 5, Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(1000, domain.DefaultCurrency)}
+	var ids []domain.ID
+	for _, code := range []string{"EV1", "EV2", "EV3"} {
+		p := base
+		p.Name, p.CodeValue = "product "+code, code
+		added, err := s.AddOne(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, added.Id)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: ids[0], Price: domain.NewMoney(1250, domain.DefaultCurrency), Quantity: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteOne(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteOne(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Restore(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	want, err := s.Find(ctx, Query{IncludeDeleted: true}.OrderBy("id", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.(*eventStore).log.Close()
+
+	if err = os.Remove(logPath + ".projection"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := RebuildProjection(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events < 7 {
+		t.Fatalf("rebuild applied %d events, want at least 7", events)
+	}
+	if _, err = os.Stat(logPath + ".projection"); err != nil {
+		t.Fatalf("rebuild did not save the projection: %v", err)
+	}
+	rebuilt, err := NewEventStore(logPath, "", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rebuilt.(*eventStore).log.Close()
+	got, err := rebuilt.Find(ctx, Query{IncludeDeleted: true}.OrderBy("id", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rebuilt projection\n%+v\nwant\n%+v", got, want)
+	}
+	all, err := rebuilt.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("rebuilt projection has %d products, want 2", len(all))
+	}
+}
+
+// TestChangeEvents comprueba el tipo de evento de las actualizaciones que cambian un solo aspecto del producto
+func TestChangeEvents(t *testing.T) {
+	current := domain.Product{Id: "1", Name: "product", Quantity: 5, CodeValue: "EV1", Price: domain.NewMoney(1000, domain.DefaultCurrency), Version: 1}
+	cases := []struct {
+		name   string
+		update func(p *domain.Product)
+		want   []string
+	}{
+		{"price", func(p *domain.Product) { p.Price = domain.NewMoney(1250, domain.DefaultCurrency) }, []string{EventPriceChanged}},
+		{"stock", func(p *domain.Product) { p.Quantity = 2 }, []string{EventStockAdjusted}},
+		{"publish", func(p *domain.Product) { p.IsPublished = true }, []string{EventPublished}},
+		{"details", func(p *domain.Product) { p.Name = "renamed" }, []string{EventDetailsChanged}},
+		{"version only", func(p *domain.Product) {}, []string{EventDetailsChanged}},
+		{"price and stock", func(p *domain.Product) { p.Price, p.Quantity = domain.NewMoney(1, domain.DefaultCurrency), 6 }, []string{EventPriceChanged, EventStockAdjusted}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			updated := current
+			c.update(&updated)
+			updated.Version++
+			var got []string
+			for _, e := range changeEvents(current, updated) {
+				if e.Version != updated.Version {
+					t.Errorf("%s event has version %d, want %d", e.Type, e.Version, updated.Version)
+				}
+				got = append(got, e.Type)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got events %v, want %v", got, c.want)
+			}
+		})
+	}
+	unpublished := current
+	current.IsPublished = true
+	unpublished.Version = 2
+	events := changeEvents(current, unpublished)
+	if len(events) != 1 || events[0].Type != EventUnpublished {
+		t.Fatalf("unpublish emitted %+v, want one %s", events, EventUnpublished)
+	}
+	if events[0].Delta != nil || events[0].Price != nil {
+		t.Fatalf("unpublish event carries other fields: %+v", events[0])
+	}
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
+)
+
+type memoryHistory struct {
+	mu      sync.RWMutex
+	entries []HistoryEntry
+}
+
+// NewMemoryHistory crea un historial en memoria, para el store memory
+func NewMemoryHistory() HistoryLog {
+	return &memoryHistory{}
+}
+
+// Append agrega las entradas
+func (h *memoryHistory) Append(ctx context.Context, tx Store, entries []HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entries...)
+	return nil
+}
+
+// List devuelve las entradas de un producto
+func (h *memoryHistory) List(ctx context.Context, id domain.ID, limit, offset int) ([]HistoryEntry, int, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return pageHistory(h.entries, id, limit, offset), countHistory(h.entries, id), nil
+}
+
+type fileHistory struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileHistory crea un historial que agrega una linea json por entrada al archivo path, para los stores json y journal
+func NewFileHistory(path string) HistoryLog {
+	return &fileHistory{path: path}
+}
+
+// Append agrega las entradas al final del archivo y lo sincroniza a disco
+func (h *fileHistory) Append(ctx context.Context, tx Store, entries []HistoryEntry) error {
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	unlock, err := fileutil.Lock(h.path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// List lee el archivo y devuelve las entradas de un producto
+func (h *fileHistory) List(ctx context.Context, id domain.ID, limit, offset int) ([]HistoryEntry, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	unlock, err := fileutil.Lock(h.path+".lock", false)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer unlock()
+	file, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []HistoryEntry{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// una ultima linea incompleta por una caida a mitad de escritura no invalida el resto
+			continue
+		}
+		if entry.ProductId == id {
+			entries = append(entries, entry)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return pageHistory(entries, id, limit, offset), len(entries), nil
+}
+
+type sqlHistory struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSqlHistory crea un historial en la tabla product_history (creada por la migracion 0005)
+func NewSqlHistory(db *sql.DB, dialect Dialect) HistoryLog {
+	return &sqlHistory{db: db, dialect: dialect}
+}
+
+// Append inserta las entradas dentro de la transaccion del store si es de la misma base
+func (h *sqlHistory) Append(ctx context.Context, tx Store, entries []HistoryEntry) error {
+	var q querier = h.db
+	if s, ok := tx.(*sqlStore); ok && s.DB == h.db {
+		q = s.q
+	}
+	stmt := h.dialect.rebind("INSERT INTO product_history(product_id, action, actor, changed_at, changes) VALUES(?, ?, ?, ?, ?)")
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+		if _, err = q.ExecContext(ctx, stmt, entry.ProductId, entry.Action, entry.Actor, entry.At, string(changes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List devuelve las entradas de un producto paginadas por la base
+func (h *sqlHistory) List(ctx context.Context, id domain.ID, limit, offset int) ([]HistoryEntry, int, error) {
+	var total int
+	err := h.db.QueryRowContext(ctx, h.dialect.rebind("SELECT COUNT(*) FROM product_history WHERE product_id = ?"), id).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := h.dialect.rebind("SELECT product_id, action, actor, changed_at, changes FROM product_history WHERE product_id = ? ORDER BY id DESC LIMIT ? OFFSET ?")
+	rows, err := h.db.QueryContext(ctx, query, id, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var at *time.Time
+		var changes string
+		if err = rows.Scan(&entry.ProductId, &entry.Action, &entry.Actor, timeColumn{&at}, &changes); err != nil {
+			return nil, 0, err
+		}
+		if at != nil {
+			entry.At = *at
+		}
+		if err = json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// pageHistory filtra las entradas de un producto y las devuelve de la mas nueva a la mas vieja, paginadas
+func pageHistory(entries []HistoryEntry, id domain.ID, limit, offset int) []HistoryEntry {
+	page := []HistoryEntry{}
+	skipped := 0
+	for i := len(entries) - 1; i >= 0 && len(page) < limit; i-- {
+		if entries[i].ProductId != id {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		page = append(page, entries[i])
+	}
+	return page
+}
+
+// countHistory cuenta las entradas de un producto
+func countHistory(entries []HistoryEntry, id domain.ID) int {
+	count := 0
+	for _, entry := range entries {
+		if entry.ProductId == id {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+// Acciones que se registran en el historial
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Change es el valor de un campo antes y despues de un cambio; Before es nil en las altas
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// HistoryEntry es un cambio sobre un producto: quien lo hizo, cuando y que campos modifico
+type HistoryEntry struct {
+	ProductId domain.ID `json:"product_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	At        time.Time `json:"at"`
+	Changes   []Change  `json:"changes"`
+}
+
+// HistoryLog guarda y lista el historial de cambios de los productos
+type HistoryLog interface {
+	// Append guarda las entradas. tx es la transaccion del store en la que se hicieron los cambios:
+	// los logs que viven en la misma base la usan para que el historial se confirme junto con los cambios
+	Append(ctx context.Context, tx Store, entries []HistoryEntry) error
+	// List devuelve las entradas de un producto de la mas nueva a la mas vieja, y el total de entradas
+	List(ctx context.Context, id domain.ID, limit, offset int) ([]HistoryEntry, int, error)
+}
+
+// historyFields son los campos que se comparan para registrar los cambios
+var historyFields = []string{"name", "quantity", "code_value", "is_published", "expiration", "price", "category_id", "variant", "deleted_at"}
+
+type historyStore struct {
+	Store
+	log HistoryLog
+	// sharedTx indica si log guarda el historial en la misma base que next, y puede hacerlo en su transaccion
+	sharedTx bool
+}
+
+// NewHistoryStore envuelve next para registrar en log cada alta, modificacion, borrado y restauracion,
+// con el actor del contexto y los valores anteriores y nuevos de cada campo modificado
+func NewHistoryStore(next Store, log HistoryLog) Store {
+	return &historyStore{Store: next, log: log, sharedTx: sharesTx(next, log)}
+}
+
+// sharesTx indica si log es una tabla de la misma base sql que next
+func sharesTx(next Store, log HistoryLog) bool {
+	s, ok := next.(*sqlStore)
+	h, isSql := log.(*sqlHistory)
+	return ok && isSql && s.DB == h.db
+}
+
+// AddOne agrega un producto y registra el alta
+func (s *historyStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	var added domain.Product
+	err := s.record(ctx, func(tx Store) error {
+		var err error
+		added, err = tx.AddOne(ctx, product)
+		return err
+	})
+	return added, err
+}
+
+// UpdateOne actualiza un producto y registra los campos modificados
+func (s *historyStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	return s.record(ctx, func(tx Store) error {
+		return tx.UpdateOne(ctx, product)
+	})
+}
+
+// DeleteOne borra un producto y registra el borrado
+func (s *historyStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	return s.record(ctx, func(tx Store) error {
+		return tx.DeleteOne(ctx, id)
+	})
+}
+
+// Restore restaura un producto y registra la restauracion
+func (s *historyStore) Restore(ctx context.Context, id domain.ID) error {
+	return s.record(ctx, func(tx Store) error {
+		return tx.Restore(ctx, id)
+	})
+}
+
+// record registra el cambio de fn. Si el historial vive en la misma base, el cambio y su historial van en una
+// transaccion, para que no quede un cambio sin registrar. Si no, fn se ejecuta directamente sobre next (una
+// transaccion en journal y events copia todo el catalogo) y el historial se guarda despues del cambio
+func (s *historyStore) record(ctx context.Context, fn func(tx Store) error) error {
+	if s.sharedTx {
+		return s.WithTx(ctx, fn)
+	}
+	recorder := &historyTx{Store: s.Store, entries: &[]HistoryEntry{}}
+	if err := fn(recorder); err != nil {
+		return err
+	}
+	if len(*recorder.entries) == 0 {
+		return nil
+	}
+	return s.log.Append(ctx, s.Store, *recorder.entries)
+}
+
+// AddMany agrega los productos con el AddMany de next y registra el alta de cada uno
+func (s *historyStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.AddMany(ctx, products)
+	})
+}
+
+// UpdateMany actualiza los productos y registra los campos modificados de cada uno
+func (s *historyStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.UpdateMany(ctx, products)
+	})
+}
+
+// DeleteMany borra los productos y registra el borrado de cada uno
+func (s *historyStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.DeleteMany(ctx, ids)
+	})
+}
+
+// WithTx ejecuta fn en una transaccion de next y guarda el historial de sus cambios en la misma transaccion
+func (s *historyStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.Store.WithTx(ctx, func(tx Store) error {
+		recorder := &historyTx{Store: tx, entries: &[]HistoryEntry{}}
+		if err := fn(recorder); err != nil {
+			return err
+		}
+		if len(*recorder.entries) == 0 {
+			return nil
+		}
+		return s.log.Append(ctx, tx, *recorder.entries)
+	})
+}
+
+// historyTx anota las entradas de historial de los cambios hechos dentro de una transaccion
+type historyTx struct {
+	Store
+	entries *[]HistoryEntry
+}
+
+// AddOne agrega un producto y anota todos sus campos como nuevos
+func (s *historyTx) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	added, err := s.Store.AddOne(ctx, product)
+	if err != nil {
+		return added, err
+	}
+	s.record(ctx, ActionCreate, added.Id, nil, &added)
+	return added, nil
+}
+
+// UpdateOne actualiza un producto y anota los campos que cambiaron
+func (s *historyTx) UpdateOne(ctx context.Context, product domain.Product) error {
+	before, err := s.findAny(ctx, product.Id)
+	if err != nil {
+		return err
+	}
+	if before == nil || before.DeletedAt != nil {
+		return s.Store.UpdateOne(ctx, product)
+	}
+	if err = s.Store.UpdateOne(ctx, product); err != nil {
+		return err
+	}
+	after, err := s.Store.GetOne(ctx, product.Id)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, ActionUpdate, product.Id, before, &after)
+	return nil
+}
+
+// DeleteOne borra un producto y anota su fecha de borrado
+func (s *historyTx) DeleteOne(ctx context.Context, id domain.ID) error {
+	return s.recordChange(ctx, ActionDelete, id, func() error { return s.Store.DeleteOne(ctx, id) })
+}
+
+// Restore restaura un producto y anota que ya no esta borrado
+func (s *historyTx) Restore(ctx context.Context, id domain.ID) error {
+	return s.recordChange(ctx, ActionRestore, id, func() error { return s.Store.Restore(ctx, id) })
+}
+
+// AddMany agrega los productos con el AddMany de la transaccion y anota el alta de cada uno
+func (s *historyTx) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	results, err := s.Store.AddMany(ctx, products)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].Err == nil {
+			s.record(ctx, ActionCreate, results[i].Product.Id, nil, &results[i].Product)
+		}
+	}
+	return results, nil
+}
+
+// UpdateMany actualiza los productos uno por uno, para anotar los campos que cambiaron en cada uno
+func (s *historyTx) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos uno por uno, para anotar la fecha de borrado de cada uno
+func (s *historyTx) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx mantiene el registro en las transacciones anidadas
+func (s *historyTx) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.Store.WithTx(ctx, func(tx Store) error {
+		return fn(&historyTx{Store: tx, entries: s.entries})
+	})
+}
+
+// recordChange lee el producto, borrado o no, antes y despues de change y anota la diferencia
+func (s *historyTx) recordChange(ctx context.Context, action string, id domain.ID, change func() error) error {
+	before, err := s.findAny(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = change(); err != nil {
+		return err
+	}
+	after, err := s.findAny(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.record(ctx, action, id, before, after)
+	return nil
+}
+
+// findAny busca un producto aunque este borrado; devuelve nil si no existe. Lo bloquea hasta el fin de la
+// transaccion para que otra no lo modifique entre la lectura y el cambio, y el valor anterior sea el real
+func (s *historyTx) findAny(ctx context.Context, id domain.ID) (*domain.Product, error) {
+	found, err := s.Store.Find(ctx, Query{Limit: 1, IncludeDeleted: true, ForUpdate: true}.Where("id", Eq, id))
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+// record anota una entrada con los campos que difieren entre before y after, si hay alguno
+func (s *historyTx) record(ctx context.Context, action string, id domain.ID, before, after *domain.Product) {
+	changes := diffFields(before, after)
+	if len(changes) == 0 {
+		return
+	}
+	*s.entries = append(*s.entries, HistoryEntry{
+		ProductId: id,
+		Action:    action,
+		Actor:     domain.ActorFrom(ctx),
+		At:        time.Now().UTC(),
+		Changes:   changes,
+	})
+}
+
+// diffFields compara dos versiones de un producto campo por campo; un producto nil no tiene valores
+func diffFields(before, after *domain.Product) []Change {
+	var changes []Change
+	for _, field := range historyFields {
+		var old, cur interface{}
+		if before != nil {
+			old = historyValue(*before, field)
+		}
+		if after != nil {
+			cur = historyValue(*after, field)
+		}
+		if old != cur {
+			changes = append(changes, Change{Field: field, Before: old, After: cur})
+		}
+	}
+	return changes
+}
+
+// historyValue devuelve el valor comparable de un campo; deleted_at se guarda como texto RFC 3339 y price con su moneda
+func historyValue(p domain.Product, field string) interface{} {
+	if field == "price" {
+		return p.Price
+	}
+	if field == "deleted_at" {
+		if p.DeletedAt == nil {
+			return nil
+		}
+		return p.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return fieldValue(p, field)
+}
@@ -1,11 +1,56 @@
 package store
 
-import "clase19/internal/domain"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+// ErrNotFound lo devuelven todos los stores cuando el producto pedido no existe
+var ErrNotFound = errors.New("product not found")
+
+// ErrVersionConflict lo devuelve UpdateOne cuando la version indicada no es la actual del producto
+var ErrVersionConflict = errors.New("product was modified by someone else, reload it and try again")
+
+// ErrDuplicateCode lo devuelven AddOne y UpdateOne, como un *DuplicateCodeError, cuando el codigo ya lo usa
+// otro producto, incluso uno borrado
+var ErrDuplicateCode = errors.New("code value already exists")
+
+// IDGenerator asigna el id de los productos nuevos (secuencia, UUIDv7, ULID)
+type IDGenerator interface {
+	NewID(ctx context.Context) (domain.ID, error)
+}
 
 type Store interface {
-	GetAll() ([]domain.Product, error)
-	GetOne(id int) (domain.Product, error)
-	AddOne(product domain.Product) (domain.Product, error)
-	UpdateOne(product domain.Product) error
-	DeleteOne(id int) error
+	GetAll(ctx context.Context) ([]domain.Product, error)
+	GetOne(ctx context.Context, id domain.ID) (domain.Product, error)
+	// Find devuelve los productos que cumplen la consulta, ordenados y paginados segun ella
+	Find(ctx context.Context, q Query) ([]domain.Product, error)
+	// AddOne agrega el producto con un id nuevo. El codigo debe ser unico, o devuelve ErrDuplicateCode
+	AddOne(ctx context.Context, product domain.Product) (domain.Product, error)
+	// UpdateOne aplica los campos no vacios de product e incrementa su version. Si product.Version no es 0
+	// debe coincidir con la version guardada, o devuelve ErrVersionConflict sin modificar nada.
+	// Si el nuevo codigo lo usa otro producto devuelve ErrDuplicateCode
+	UpdateOne(ctx context.Context, product domain.Product) error
+	// DeleteOne marca el producto como borrado; GetOne, GetAll y Find dejan de devolverlo
+	DeleteOne(ctx context.Context, id domain.ID) error
+	// Restore deshace el borrado de un producto, o devuelve ErrNotFound si no existe o no esta borrado
+	Restore(ctx context.Context, id domain.ID) error
+	// Purge elimina definitivamente los productos borrados antes de la fecha dada y devuelve cuantos elimino
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// AddMany agrega los productos en una sola transaccion y devuelve un resultado por producto, en el mismo orden.
+	// Los de codigo repetido se informan en su resultado sin impedir que se guarden los demas.
+	// Los stores sin una escritura en lote usan AddEach
+	AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error)
+	// UpdateMany aplica UpdateOne a cada producto en una sola transaccion y devuelve como quedaron. Los que no
+	// existen, tienen una version vieja o un codigo repetido se informan en su resultado. Los stores sin una
+	// escritura en lote usan UpdateEach
+	UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error)
+	// DeleteMany borra los productos en una sola transaccion; los que no existen se informan en su resultado.
+	// Los stores sin un borrado en lote usan DeleteEach
+	DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error)
+	// WithTx ejecuta fn como una unidad de trabajo: si devuelve error no se aplica ningun cambio
+	WithTx(ctx context.Context, fn func(tx Store) error) error
 }
@@ -0,0 +1,473 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
+)
+
+const defaultCompactEvery = 1000
+
+// journalOp es un cambio sobre un producto. put guarda el producto completo (incluso borrado), delete lo purga por id
+type journalOp struct {
+	Op      string          `json:"op"`
+	Id      domain.ID       `json:"id"`
+	Product *domain.Product `json:"product,omitempty"`
+}
+
+// journalRecord es una linea del journal; sus operaciones se aplican todas o ninguna
+type journalRecord struct {
+	Ops []journalOp `json:"ops"`
+}
+
+type journalStore struct {
+	mu           sync.Mutex
+	snapshotPath string
+	journalPath  string
+	journal      *os.File
+	products     map[domain.ID]domain.Product
+	gen          IDGenerator
+	records      int
+	compactEvery int
+	// snapshot es el snapshot cargado y offset los bytes del journal ya aplicados, para detectar los cambios
+	// que escribio otro proceso sobre los mismos archivos
+	snapshot os.FileInfo
+	offset   int64
+}
+
+// NewJournalStore crea un store que carga el snapshot (con el formato de products.json), reproduce el journal
+// y guarda cada cambio agregando una linea al journal. Cada compactEvery escrituras vuelca todo a un nuevo snapshot.
+// Si gen es nil los ids siguen al mayor id numerico conocido.
+// Varios procesos pueden compartir los archivos: cada operacion toma un bloqueo advisory sobre snapshotPath.lock
+// y antes aplica lo que los otros procesos escribieron.
+func NewJournalStore(snapshotPath string, compactEvery int, gen IDGenerator) (Store, error) {
+	if compactEvery <= 0 {
+		compactEvery = defaultCompactEvery
+	}
+	s := &journalStore{
+		snapshotPath: snapshotPath,
+		journalPath:  snapshotPath + ".journal",
+		products:     map[domain.ID]domain.Product{},
+		gen:          defaultGenerator(gen),
+		compactEvery: compactEvery,
+	}
+	journal, err := os.OpenFile(s.journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = journal
+	unlock, err := s.lock(true)
+	if err != nil {
+		journal.Close()
+		return nil, err
+	}
+	unlock()
+	return s, nil
+}
+
+// lock toma el mutex del proceso y el bloqueo advisory de los archivos, exclusivo para escribir y compartido
+// para leer, y pone al dia el indice con lo que escribieron otros procesos
+func (s *journalStore) lock(exclusive bool) (func(), error) {
+	s.mu.Lock()
+	unlockFile, err := fileutil.Lock(s.snapshotPath+".lock", exclusive)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if err = s.refresh(); err != nil {
+		unlockFile()
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		s.mu.Unlock()
+	}, nil
+}
+
+// refresh recarga todo si otro proceso compacto (el snapshot cambio o el journal se achico) y si no aplica
+// solo las lineas del journal agregadas desde la ultima lectura
+func (s *journalStore) refresh() error {
+	snapshot, err := os.Stat(s.snapshotPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	journal, err := os.Stat(s.journalPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	compacted := (snapshot == nil) != (s.snapshot == nil) || (snapshot != nil && !sameSnapshot(snapshot, s.snapshot)) ||
+		(journal != nil && journal.Size() < s.offset)
+	if compacted {
+		s.products = map[domain.ID]domain.Product{}
+		s.records, s.offset = 0, 0
+		if err = s.loadSnapshot(); err != nil {
+			return err
+		}
+	}
+	if journal == nil || journal.Size() == s.offset {
+		return nil
+	}
+	return s.replay()
+}
+
+// sameSnapshot indica si dos lecturas del snapshot son del mismo archivo. Ademas del inodo compara largo y fecha,
+// ya que al reemplazar el snapshot varias veces el sistema puede reusar el inodo de uno anterior
+func sameSnapshot(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// loadSnapshot carga el snapshot si existe
+func (s *journalStore) loadSnapshot() error {
+	info, err := os.Stat(s.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		s.snapshot = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.snapshot = info
+	file, err := os.ReadFile(s.snapshotPath)
+	if err != nil {
+		return err
+	}
+	var products []domain.Product
+	if err = json.Unmarshal(file, &products); err != nil {
+		return err
+	}
+	seedVersions(products)
+	for _, p := range products {
+		s.products[p.Id] = p
+	}
+	observeIDs(s.gen, products)
+	return nil
+}
+
+// replay aplica las lineas del journal desde offset. Una ultima linea incompleta, producto de una caida
+// a mitad de escritura, se descarta y se trunca el archivo.
+func (s *journalStore) replay() error {
+	file, err := os.OpenFile(s.journalPath, os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Seek(s.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	offset := s.offset
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			s.offset = offset
+			if len(bytes.TrimSpace(line)) > 0 {
+				return file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var record journalRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			s.offset = offset
+			return file.Truncate(offset)
+		}
+		s.apply(record.Ops)
+		s.records++
+		offset += int64(len(line))
+	}
+}
+
+// apply aplica operaciones sobre el indice en memoria
+func (s *journalStore) apply(ops []journalOp) {
+	for _, op := range ops {
+		switch op.Op {
+		case "put":
+			s.products[op.Id] = *op.Product
+			observeIDs(s.gen, []domain.Product{*op.Product})
+		case "delete":
+			delete(s.products, op.Id)
+		}
+	}
+}
+
+// write agrega las operaciones al journal como una sola linea, sincroniza a disco y recien entonces las aplica
+func (s *journalStore) write(ops []journalOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(journalRecord{Ops: ops})
+	if err != nil {
+		return err
+	}
+	info, err := s.journal.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = s.journal.Write(append(line, '\n')); err != nil {
+		s.journal.Truncate(info.Size())
+		return err
+	}
+	if err = s.journal.Sync(); err != nil {
+		s.journal.Truncate(info.Size())
+		return err
+	}
+	s.apply(ops)
+	s.records++
+	s.offset = info.Size() + int64(len(line)) + 1
+	if s.records >= s.compactEvery {
+		// el cambio ya quedo en el journal, si falla la compactacion se reintenta en la proxima escritura
+		if err = s.compact(); err != nil {
+			log.Printf("journal compaction failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// compact vuelca el estado a un nuevo snapshot y vacia el journal
+func (s *journalStore) compact() error {
+	data, err := json.Marshal(s.sorted())
+	if err != nil {
+		return err
+	}
+	if err = fileutil.WriteAtomic(s.snapshotPath, data, 0644); err != nil {
+		return err
+	}
+	if s.snapshot, err = os.Stat(s.snapshotPath); err != nil {
+		return err
+	}
+	if err = s.journal.Truncate(0); err != nil {
+		return err
+	}
+	s.records, s.offset = 0, 0
+	return s.journal.Sync()
+}
+
+// sorted devuelve los productos ordenados por id
+func (s *journalStore) sorted() []domain.Product {
+	products := make([]domain.Product, 0, len(s.products))
+	for _, p := range s.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Id.Less(products[j].Id) })
+	return products
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *journalStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return applyQuery(s.sorted(), Query{})
+}
+
+// GetOne devuelve un producto por su id
+func (s *journalStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, err
+	}
+	unlock, err := s.lock(false)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	defer unlock()
+	product, ok := s.products[id]
+	if !ok || product.DeletedAt != nil {
+		return domain.Product{}, ErrNotFound
+	}
+	return product, nil
+}
+
+// Find evalua la consulta sobre el indice en memoria
+func (s *journalStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return applyQuery(s.sorted(), q)
+}
+
+// AddOne agrega un nuevo producto
+func (s *journalStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	defer unlock()
+	if err := checkCode(s.sorted(), product.CodeValue, ""); err != nil {
+		return domain.Product{}, err
+	}
+	id, err := s.gen.NewID(ctx)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	product.Id = id
+	product.Version = 1
+	product.DeletedAt = nil
+	if err := s.write([]journalOp{{Op: "put", Id: product.Id, Product: &product}}); err != nil {
+		return domain.Product{}, err
+	}
+	return product, nil
+}
+
+// UpdateOne actualiza un producto
+func (s *journalStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, ok := s.products[product.Id]
+	if !ok || p.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkCode(s.sorted(), product.CodeValue, product.Id); err != nil {
+		return err
+	}
+	updated, err := updateProduct(p, product)
+	if err != nil {
+		return err
+	}
+	return s.write([]journalOp{{Op: "put", Id: updated.Id, Product: &updated}})
+}
+
+// DeleteOne marca un producto como borrado
+func (s *journalStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, ok := s.products[id]
+	if !ok || p.DeletedAt != nil {
+		return ErrNotFound
+	}
+	p.DeletedAt = deletedNow()
+	p.Version++
+	return s.write([]journalOp{{Op: "put", Id: id, Product: &p}})
+}
+
+// Restore deshace el borrado de un producto
+func (s *journalStore) Restore(ctx context.Context, id domain.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	p, ok := s.products[id]
+	if !ok || p.DeletedAt == nil {
+		return ErrNotFound
+	}
+	p.DeletedAt = nil
+	p.Version++
+	return s.write([]journalOp{{Op: "put", Id: id, Product: &p}})
+}
+
+// Purge elimina los productos borrados antes de before con una sola linea del journal
+func (s *journalStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	var ops []journalOp
+	for id, p := range s.products {
+		if purgeable(p, before) {
+			ops = append(ops, journalOp{Op: "delete", Id: id})
+		}
+	}
+	if err := s.write(ops); err != nil {
+		return 0, err
+	}
+	return len(ops), nil
+}
+
+// AddMany agrega los productos con una sola linea del journal
+func (s *journalStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return AddEach(ctx, s, products)
+}
+
+// UpdateMany actualiza los productos con una sola linea del journal
+func (s *journalStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos con una sola linea del journal
+func (s *journalStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx ejecuta fn sobre una copia en memoria y escribe todos sus cambios en una sola linea del journal
+func (s *journalStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tx := NewMemoryStore(s.sorted(), s.gen).(*memoryStore)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return s.write(s.diff(tx.products))
+}
+
+// diff calcula las operaciones que llevan el indice actual a la lista de productos dada
+func (s *journalStore) diff(products []domain.Product) []journalOp {
+	var ops []journalOp
+	seen := map[domain.ID]bool{}
+	for i, p := range products {
+		seen[p.Id] = true
+		if current, ok := s.products[p.Id]; !ok || current != p {
+			ops = append(ops, journalOp{Op: "put", Id: p.Id, Product: &products[i]})
+		}
+	}
+	for id := range s.products {
+		if !seen[id] {
+			ops = append(ops, journalOp{Op: "delete", Id: id})
+		}
+	}
+	return ops
+}
@@ -1,26 +1,36 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"os"
+	"reflect"
+	"sync"
+	"time"
 
 	"clase19/internal/domain"
+	"clase19/pkg/fileutil"
 )
 
 type jsonStore struct {
+	mu         sync.RWMutex
 	pathToFile string
+	gen        IDGenerator
 }
 
-// NewJsonStore crea un nuevo store de products
-func NewJsonStore(path string) Store {
+// NewJsonStore crea un nuevo store de products. Si gen es nil los ids siguen al mayor id numerico del archivo
+func NewJsonStore(path string, gen IDGenerator) Store {
 	return &jsonStore{
 		pathToFile: path,
+		gen:        defaultGenerator(gen),
 	}
 }
 
 // loadProducts carga los productos desde un archivo json
-func (s *jsonStore) loadProducts() ([]domain.Product, error) {
+func (s *jsonStore) loadProducts(ctx context.Context) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var products []domain.Product
 	file, err := os.ReadFile(s.pathToFile)
 	if err != nil {
@@ -30,6 +40,7 @@ func (s *jsonStore) loadProducts() ([]domain.Product, error) {
 	if err != nil {
 		return nil, err
 	}
+	seedVersions(products)
 	return products, nil
 }
 
@@ -39,39 +50,99 @@ func (s *jsonStore) saveProducts(products []domain.Product) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.pathToFile, bytes, 0644)
+	return fileutil.WriteAtomic(s.pathToFile, bytes, 0644)
 }
 
-// GetAll devuelve todos los productos
-func (s *jsonStore) GetAll() ([]domain.Product, error) {
-	products, err := s.loadProducts()
+// lock toma el mutex del proceso y el bloqueo advisory del archivo, exclusivos para escribir y compartidos para leer
+func (s *jsonStore) lock(exclusive bool) (func(), error) {
+	if exclusive {
+		s.mu.Lock()
+	} else {
+		s.mu.RLock()
+	}
+	unlockMu := s.mu.RUnlock
+	if exclusive {
+		unlockMu = s.mu.Unlock
+	}
+	unlockFile, err := fileutil.Lock(s.pathToFile+".lock", exclusive)
 	if err != nil {
+		unlockMu()
 		return nil, err
 	}
-	return products, nil
+	return func() {
+		unlockFile()
+		unlockMu()
+	}, nil
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *jsonStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	products, err := s.loadProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return applyQuery(products, Query{})
 }
 
 // GetOne devuelve un producto por su id
-func (s *jsonStore) GetOne(id int) (domain.Product, error) {
-	products, err := s.loadProducts()
+func (s *jsonStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	defer unlock()
+	products, err := s.loadProducts(ctx)
 	if err != nil {
 		return domain.Product{}, err
 	}
 	for _, product := range products {
-		if product.Id == id {
+		if product.Id == id && product.DeletedAt == nil {
 			return product, nil
 		}
 	}
-	return domain.Product{}, errors.New("product not found")
+	return domain.Product{}, ErrNotFound
+}
+
+// Find carga el archivo y evalua la consulta en memoria
+func (s *jsonStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	products, err := s.loadProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return applyQuery(products, q)
 }
 
 // AddOne agrega un nuevo producto
-func (s *jsonStore) AddOne(product domain.Product) (domain.Product, error) {
-	products, err := s.loadProducts()
+func (s *jsonStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	defer unlock()
+	products, err := s.loadProducts(ctx)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	if err := checkCode(products, product.CodeValue, ""); err != nil {
+		return domain.Product{}, err
+	}
+	observeIDs(s.gen, products)
+	product.Id, err = s.gen.NewID(ctx)
 	if err != nil {
 		return domain.Product{}, err
 	}
-	product.Id = len(products) + 1
+	product.Version = 1
+	product.DeletedAt = nil
 	products = append(products, product)
 	err = s.saveProducts(products)
 	if err != nil {
@@ -81,59 +152,89 @@ func (s *jsonStore) AddOne(product domain.Product) (domain.Product, error) {
 }
 
 // UpdateOne actualiza un producto
-func (s *jsonStore) UpdateOne(product domain.Product) error {
-	products, err := s.loadProducts()
+func (s *jsonStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	products, err := s.loadProducts(ctx)
 	if err != nil {
 		return err
 	}
 	for i, p := range products {
-		if p.Id == product.Id {
-			productUpdated, err := s.completeEmptyAttributes(p, product)
+		if p.Id == product.Id && p.DeletedAt == nil {
+			if err := checkCode(products, product.CodeValue, product.Id); err != nil {
+				return err
+			}
+			products[i], err = updateProduct(p, product)
 			if err != nil {
 				return err
 			}
-			products[i] = productUpdated
 			return s.saveProducts(products)
 		}
 	}
-	return errors.New("product not found")
+	return ErrNotFound
 }
 
-// DeleteOne elimina un producto
-func (s *jsonStore) DeleteOne(id int) error {
-	products, err := s.loadProducts()
-	if err != nil {
+// DeleteOne marca un producto como borrado
+func (s *jsonStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return tx.DeleteOne(ctx, id)
+	})
+}
+
+// Restore deshace el borrado de un producto
+func (s *jsonStore) Restore(ctx context.Context, id domain.ID) error {
+	return s.WithTx(ctx, func(tx Store) error {
+		return tx.Restore(ctx, id)
+	})
+}
+
+// Purge elimina del archivo los productos borrados antes de before
+func (s *jsonStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		purged, err = tx.Purge(ctx, before)
 		return err
-	}
-	for i, p := range products {
-		if p.Id == id {
-			products = append(products[:i], products[i+1:]...)
-			return s.saveProducts(products)
-		}
-	}
-	return errors.New("product not found")
+	})
+	return purged, err
 }
 
-// completeEmptyAttributes compara dos productos y se queda con los campos diferentes
-func (s *jsonStore) completeEmptyAttributes(product domain.Product, updatedProduct domain.Product) (domain.Product, error) {
-	p := product
-	if updatedProduct.Name != "" {
-		p.Name = updatedProduct.Name
-	}
-	if updatedProduct.Quantity != 0 {
-		p.Quantity = updatedProduct.Quantity
-	}
-	if updatedProduct.CodeValue != "" {
-		p.CodeValue = updatedProduct.CodeValue
+// AddMany agrega los productos cargando y guardando el archivo una sola vez
+func (s *jsonStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return AddEach(ctx, s, products)
+}
+
+// UpdateMany actualiza los productos cargando y guardando el archivo una sola vez
+func (s *jsonStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos cargando y guardando el archivo una sola vez
+func (s *jsonStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx carga los productos una sola vez, ejecuta fn sobre ellos en memoria y guarda el archivo solo si no hubo
+// error y fn cambio algo, asi las transacciones de solo lectura no reescriben el archivo
+func (s *jsonStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
 	}
-	if updatedProduct.IsPublished {
-		p.IsPublished = updatedProduct.IsPublished
+	defer unlock()
+	products, err := s.loadProducts(ctx)
+	if err != nil {
+		return err
 	}
-	if updatedProduct.Expiration != "" {
-		p.Expiration = updatedProduct.Expiration
+	tx := NewMemoryStore(products, s.gen).(*memoryStore)
+	if err = fn(tx); err != nil {
+		return err
 	}
-	if updatedProduct.Price != 0.0 {
-		p.Price = updatedProduct.Price
+	if reflect.DeepEqual(products, tx.products) {
+		return nil
 	}
-	return p, nil
+	return s.saveProducts(tx.products)
 }
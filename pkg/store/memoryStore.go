@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"clase19/internal/domain"
+)
+
+type memoryStore struct {
+	mu       sync.RWMutex
+	products []domain.Product
+	gen      IDGenerator
+}
+
+// NewMemoryStore crea un nuevo store de products en memoria. Si gen es nil los ids siguen una secuencia en memoria
+func NewMemoryStore(products []domain.Product, gen IDGenerator) Store {
+	s := &memoryStore{
+		products: make([]domain.Product, len(products)),
+		gen:      defaultGenerator(gen),
+	}
+	copy(s.products, products)
+	seedVersions(s.products)
+	observeIDs(s.gen, s.products)
+	return s
+}
+
+// NewMemoryStoreFromFile crea un nuevo store en memoria cargado desde un archivo json
+func NewMemoryStoreFromFile(path string, gen IDGenerator) (Store, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var products []domain.Product
+	err = json.Unmarshal(file, &products)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryStore(products, gen), nil
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *memoryStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	products := []domain.Product{}
+	for _, p := range s.products {
+		if p.DeletedAt == nil {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// GetOne devuelve un producto por su id
+func (s *memoryStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.indexOf(id, false)
+	if i < 0 {
+		return domain.Product{}, ErrNotFound
+	}
+	return s.products[i], nil
+}
+
+// Find evalua la consulta sobre los productos en memoria
+func (s *memoryStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return applyQuery(s.products, q)
+}
+
+// AddOne agrega un nuevo producto, o devuelve un DuplicateCodeError si su codigo ya esta en uso
+func (s *memoryStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Product{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkCode(s.products, product.CodeValue, ""); err != nil {
+		return domain.Product{}, err
+	}
+	id, err := s.gen.NewID(ctx)
+	if err != nil {
+		return domain.Product{}, err
+	}
+	product.Id = id
+	product.Version = 1
+	product.DeletedAt = nil
+	s.products = append(s.products, product)
+	return product, nil
+}
+
+// UpdateOne actualiza un producto, o devuelve un DuplicateCodeError si pasaria a usar el codigo de otro
+func (s *memoryStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(product.Id, false)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if err := checkCode(s.products, product.CodeValue, product.Id); err != nil {
+		return err
+	}
+	updated, err := updateProduct(s.products[i], product)
+	if err != nil {
+		return err
+	}
+	s.products[i] = updated
+	return nil
+}
+
+// DeleteOne marca un producto como borrado
+func (s *memoryStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id, false)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.products[i].DeletedAt = deletedNow()
+	s.products[i].Version++
+	return nil
+}
+
+// Restore deshace el borrado de un producto
+func (s *memoryStore) Restore(ctx context.Context, id domain.ID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.indexOf(id, true)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.products[i].DeletedAt = nil
+	s.products[i].Version++
+	return nil
+}
+
+// Purge elimina los productos borrados antes de before
+func (s *memoryStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.products[:0]
+	for _, p := range s.products {
+		if !purgeable(p, before) {
+			kept = append(kept, p)
+		}
+	}
+	purged := len(s.products) - len(kept)
+	s.products = kept
+	return purged, nil
+}
+
+// AddMany agrega los productos sobre una copia que se aplica al final
+func (s *memoryStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return AddEach(ctx, s, products)
+}
+
+// UpdateMany actualiza los productos sobre una copia que se aplica al final
+func (s *memoryStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos sobre una copia que se aplica al final
+func (s *memoryStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// WithTx ejecuta fn sobre una copia de los productos con el store bloqueado, y la aplica solo si no hubo error
+func (s *memoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &memoryStore{
+		products: make([]domain.Product, len(s.products)),
+		gen:      s.gen,
+	}
+	copy(tx.products, s.products)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.products = tx.products
+	return nil
+}
+
+// indexOf devuelve la posicion de un producto por su id, o -1 si no existe o si su estado de borrado no es deleted
+func (s *memoryStore) indexOf(id domain.ID, deleted bool) int {
+	for i, p := range s.products {
+		if p.Id == id {
+			if (p.DeletedAt != nil) != deleted {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"clase19/internal/domain"
+)
+
+// Operator es la comparacion de un filtro
+type Operator string
+
+const (
+	Eq  Operator = "="
+	Ne  Operator = "<>"
+	Gt  Operator = ">"
+	Gte Operator = ">="
+	Lt  Operator = "<"
+	Lte Operator = "<="
+	In  Operator = "IN"
+)
+
+// Filter compara un campo del producto (con su nombre json, ej. price) contra un valor. Para In el valor es un slice de valores
+type Filter struct {
+	Field string
+	Op    Operator
+	Value interface{}
+}
+
+// Sort ordena por un campo del producto
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query describe una busqueda de productos: todos los filtros deben cumplirse, y Limit 0 significa sin limite.
+// Los productos borrados solo se incluyen si IncludeDeleted es true
+type Query struct {
+	Filters        []Filter
+	Sort           []Sort
+	Limit          int
+	Offset         int
+	IncludeDeleted bool
+	// ForUpdate bloquea los productos encontrados hasta el fin de la transaccion (SELECT ... FOR UPDATE), para
+	// que otra transaccion no los modifique entre la lectura y la escritura. Solo tiene efecto dentro de WithTx
+	// en MySQL y Postgres; los otros stores ya serializan sus transacciones
+	ForUpdate bool
+}
+
+// Where agrega un filtro a la consulta
+func (q Query) Where(field string, op Operator, value interface{}) Query {
+	q.Filters = append(q.Filters, Filter{Field: field, Op: op, Value: value})
+	return q
+}
+
+// OrderBy agrega un orden a la consulta
+func (q Query) OrderBy(field string, desc bool) Query {
+	q.Sort = append(q.Sort, Sort{Field: field, Desc: desc})
+	return q
+}
+
+// queryFields son los campos por los que se puede filtrar y ordenar, que coinciden con las columnas de la tabla
+var queryFields = map[string]bool{
+	"id":           true,
+	"name":         true,
+	"quantity":     true,
+	"code_value":   true,
+	"is_published": true,
+	"expiration":   true,
+	"price":        true,
+	"version":      true,
+	"category_id":  true,
+	"parent_id":    true,
+	"variant":      true,
+}
+
+// validate comprueba campos, operadores y paginado
+func (q Query) validate() error {
+	for _, f := range q.Filters {
+		if !queryFields[f.Field] {
+			return fmt.Errorf("invalid filter field %q", f.Field)
+		}
+		switch f.Op {
+		case Eq, Ne, Gt, Gte, Lt, Lte:
+		case In:
+			if _, ok := inValues(f.Value); !ok {
+				return fmt.Errorf("filter %s IN needs a slice value", f.Field)
+			}
+		default:
+			return fmt.Errorf("invalid filter operator %q", f.Op)
+		}
+	}
+	for _, s := range q.Sort {
+		if !queryFields[s.Field] {
+			return fmt.Errorf("invalid sort field %q", s.Field)
+		}
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("invalid limit or offset")
+	}
+	return nil
+}
+
+// applyQuery evalua la consulta en memoria, para los stores que no tienen un motor de consultas
+func applyQuery(products []domain.Product, q Query) ([]domain.Product, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	result := []domain.Product{}
+	for _, p := range products {
+		if p.DeletedAt != nil && !q.IncludeDeleted {
+			continue
+		}
+		if matches(p, q.Filters) {
+			result = append(result, p)
+		}
+	}
+	if len(q.Sort) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			for _, s := range q.Sort {
+				c := compare(fieldValue(result[i], s.Field), fieldValue(result[j], s.Field))
+				if c == 0 {
+					continue
+				}
+				if s.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+	if q.Offset >= len(result) {
+		return []domain.Product{}, nil
+	}
+	result = result[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(result) {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+// matches indica si el producto cumple todos los filtros
+func matches(p domain.Product, filters []Filter) bool {
+	for _, f := range filters {
+		value := fieldValue(p, f.Field)
+		if f.Op == In {
+			found := false
+			values, _ := inValues(f.Value)
+			for _, v := range values {
+				if compare(value, v) == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+			continue
+		}
+		c := compare(value, f.Value)
+		ok := false
+		switch f.Op {
+		case Eq:
+			ok = c == 0
+		case Ne:
+			ok = c != 0
+		case Gt:
+			ok = c > 0
+		case Gte:
+			ok = c >= 0
+		case Lt:
+			ok = c < 0
+		case Lte:
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldValue devuelve el valor de un campo del producto por su nombre json
+func fieldValue(p domain.Product, field string) interface{} {
+	switch field {
+	case "id":
+		return p.Id
+	case "name":
+		return p.Name
+	case "quantity":
+		return p.Quantity
+	case "code_value":
+		return p.CodeValue
+	case "is_published":
+		return p.IsPublished
+	case "expiration":
+		return p.Expiration
+	case "price":
+		return p.Price.Amount
+	case "version":
+		return p.Version
+	case "category_id":
+		return p.CategoryId
+	case "parent_id":
+		return p.ParentId
+	case "variant":
+		return p.Variant
+	}
+	return nil
+}
+
+// compare compara dos valores del mismo tipo de campo; los numeros se comparan como float64, los importes en
+// centavos y las fechas contra otra fecha o un texto en alguno de los formatos aceptados
+func compare(a, b interface{}) int {
+	if date, ok := a.(domain.Date); ok {
+		other, ok := b.(domain.Date)
+		if !ok {
+			other, _ = domain.ParseDate(fmt.Sprint(b))
+		}
+		switch {
+		case date == other:
+			return 0
+		case date.Before(other):
+			return -1
+		}
+		return 1
+	}
+	if amount, ok := a.(domain.Amount); ok {
+		other, ok := b.(domain.Amount)
+		if !ok {
+			f, _ := toFloat(b)
+			other = domain.AmountFromFloat(f)
+		}
+		switch {
+		case amount < other:
+			return -1
+		case amount > other:
+			return 1
+		}
+		return 0
+	}
+	if id, ok := a.(domain.ID); ok {
+		other := domain.ID(fmt.Sprint(b))
+		switch {
+		case id == other:
+			return 0
+		case id.Less(other):
+			return -1
+		}
+		return 1
+	}
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	if x, ok := a.(bool); ok {
+		y, _ := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// inValues convierte el valor de un filtro In, que puede ser cualquier slice, en []interface{}
+func inValues(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+// toFloat convierte los tipos numericos a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// sqlWhere traduce la consulta a condiciones y orden de SQL del dialecto d con parametros ?
+func (q Query) sqlWhere(d Dialect) (string, []interface{}, error) {
+	if err := q.validate(); err != nil {
+		return "", nil, err
+	}
+	var conditions []string
+	var args []interface{}
+	if !q.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	for _, f := range q.Filters {
+		if f.Op == In {
+			values, _ := inValues(f.Value)
+			if len(values) == 0 {
+				conditions = append(conditions, "1 = 0")
+				continue
+			}
+			marks := strings.TrimSuffix(strings.Repeat(d.compared(f.Field, "?")+", ", len(values)), ", ")
+			conditions = append(conditions, d.compared(f.Field, f.Field)+" IN ("+marks+")")
+			args = append(args, values...)
+			continue
+		}
+		conditions = append(conditions, d.compared(f.Field, f.Field)+" "+string(f.Op)+" "+d.compared(f.Field, "?"))
+		args = append(args, f.Value)
+	}
+	var b strings.Builder
+	if len(conditions) > 0 {
+		b.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	if len(q.Sort) > 0 {
+		var order []string
+		for _, s := range q.Sort {
+			direction := ""
+			if s.Desc {
+				direction = " DESC"
+			}
+			if s.Field == "id" {
+				// igual que domain.ID.Less: los ids numericos guardados como texto se ordenan por largo y luego por valor
+				order = append(order, "LENGTH(id)"+direction, "id"+direction)
+				continue
+			}
+			order = append(order, d.compared(s.Field, s.Field)+direction)
+		}
+		b.WriteString(" ORDER BY " + strings.Join(order, ", "))
+	}
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := int64(q.Limit)
+		if limit == 0 {
+			limit = 1<<63 - 1
+		}
+		b.WriteString(" LIMIT ? OFFSET ?")
+		args = append(args, limit, q.Offset)
+	}
+	if q.ForUpdate && d.rowLocks {
+		b.WriteString(" FOR UPDATE")
+	}
+	return b.String(), args, nil
+}
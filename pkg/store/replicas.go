@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReplicaCheckEvery = 5 * time.Second
+	replicaPingTimeout       = 2 * time.Second
+)
+
+type primaryKey struct{}
+
+// WithPrimary marca el contexto para que las lecturas vayan a la base primaria y no a una replica,
+// para leer lo recien escrito sin el retraso de la replicacion
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// primaryRequested indica si el contexto pide leer de la base primaria
+func primaryRequested(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// replicaSet reparte las lecturas entre las replicas que responden al ping
+type replicaSet struct {
+	dbs     []*sql.DB
+	healthy []int32
+	next    uint32
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// newReplicaSet comprueba las replicas y las vuelve a comprobar cada checkEvery hasta que se llame a close
+func newReplicaSet(dbs []*sql.DB, checkEvery time.Duration) *replicaSet {
+	if checkEvery <= 0 {
+		checkEvery = defaultReplicaCheckEvery
+	}
+	r := &replicaSet{dbs: dbs, healthy: make([]int32, len(dbs)), stop: make(chan struct{})}
+	r.check()
+	go func() {
+		ticker := time.NewTicker(checkEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.check()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// close detiene la comprobacion periodica de las replicas
+func (r *replicaSet) close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+// check hace ping a cada replica y actualiza cuales estan sanas
+func (r *replicaSet) check() {
+	for i, db := range r.dbs {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaPingTimeout)
+		err := db.PingContext(ctx)
+		cancel()
+		var healthy int32
+		if err == nil {
+			healthy = 1
+		}
+		if atomic.SwapInt32(&r.healthy[i], healthy) != healthy && err != nil {
+			log.Printf("read replica %d is down, reading from the primary: %v", i, err)
+		}
+	}
+}
+
+// pick devuelve la siguiente replica sana en ronda, o -1 si no hay ninguna
+func (r *replicaSet) pick() (int, *sql.DB) {
+	start := atomic.AddUint32(&r.next, 1)
+	for k := 0; k < len(r.dbs); k++ {
+		i := int((start + uint32(k)) % uint32(len(r.dbs)))
+		if atomic.LoadInt32(&r.healthy[i]) == 1 {
+			return i, r.dbs[i]
+		}
+	}
+	return -1, nil
+}
+
+// markDown saca una replica de la ronda hasta que vuelva a responder al ping
+func (r *replicaSet) markDown(i int, err error) {
+	if atomic.SwapInt32(&r.healthy[i], 0) == 1 {
+		log.Printf("read replica %d failed, reading from the primary: %v", i, err)
+	}
+}
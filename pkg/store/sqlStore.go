@@ -2,138 +2,587 @@ package store
 
 import (
 	"clase19/internal/domain"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+const productColumns = "id, name, quantity, code_value, is_published, expiration, price, currency, version, category_id, parent_id, variant, deleted_at"
+
+// productRow son los valores de un INSERT de productColumns; un producto nuevo no esta borrado
+const productRow = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)"
+
+// sqlMaxParams es el limite de parametros por sentencia de sqlite (anterior a 3.32), el menor de los tres motores
+const sqlMaxParams = 999
+
+// querier es lo comun entre *sql.DB y *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
 type sqlStore struct {
-	DB *sql.DB
+	DB      *sql.DB
+	dialect Dialect
+	gen     IDGenerator
+	// q es la conexion o la transaccion en curso
+	q querier
+	// replicas reciben las lecturas fuera de las transacciones; nil si no hay
+	replicas *replicaSet
 }
 
-// NewSqlStore crea un nuevo store de products
-func NewSqlStore(db *sql.DB) Store {
+// NewSqlStore crea un nuevo store de products para el dialecto indicado.
+// Si gen es nil los ids salen de la secuencia guardada en la tabla id_sequence.
+func NewSqlStore(db *sql.DB, dialect Dialect, gen IDGenerator) Store {
 	return &sqlStore{
-		DB: db,
+		DB:      db,
+		dialect: dialect,
+		gen:     gen,
+		q:       db,
 	}
 }
 
-// GetAll devuelve todos los productos
-func (s *sqlStore) GetAll() ([]domain.Product, error) {
-	var products []domain.Product
+// NewReplicatedSqlStore crea un store que escribe en primary y reparte las lecturas en ronda entre las replicas
+// que responden al ping, comprobadas cada checkEvery. Lee de primary dentro de las transacciones, con un contexto
+// marcado con WithPrimary o si no hay replicas sanas.
+func NewReplicatedSqlStore(primary *sql.DB, replicas []*sql.DB, dialect Dialect, gen IDGenerator, checkEvery time.Duration) Store {
+	s := NewSqlStore(primary, dialect, gen).(*sqlStore)
+	if len(replicas) > 0 {
+		s.replicas = newReplicaSet(replicas, checkEvery)
+	}
+	return s
+}
 
-	query := "SELECT * FROM products"
-	rows, err := s.DB.Query(query)
-	if err != nil {
-		return []domain.Product{}, err
+// Close detiene la comprobacion periodica de las replicas. Las conexiones las abrio el llamador, que debe cerrarlas
+func (s *sqlStore) Close() error {
+	if s.replicas != nil {
+		s.replicas.close()
 	}
-	defer rows.Close()
+	return nil
+}
 
-	for rows.Next() {
-		var productReturn domain.Product
-		err = rows.Scan(&productReturn.Id, &productReturn.Name, &productReturn.Quantity, &productReturn.CodeValue, &productReturn.IsPublished, &productReturn.Expiration, &productReturn.Price)
+// read ejecuta la consulta fn en una replica si corresponde, o en la conexion del store. Si la replica falla
+// la saca de la ronda y repite la consulta en la primaria
+func (s *sqlStore) read(ctx context.Context, fn func(q querier) error) error {
+	if _, inTx := s.q.(*sql.Tx); inTx || s.replicas == nil || primaryRequested(ctx) {
+		return fn(s.q)
+	}
+	i, replica := s.replicas.pick()
+	if replica == nil {
+		return fn(s.q)
+	}
+	err := fn(replica)
+	if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+		return err
+	}
+	s.replicas.markDown(i, err)
+	return fn(s.q)
+}
+
+// GetAll devuelve todos los productos no borrados
+func (s *sqlStore) GetAll(ctx context.Context) ([]domain.Product, error) {
+	var products []domain.Product
+
+	query := "SELECT " + productColumns + " FROM products WHERE deleted_at IS NULL"
+	err := s.read(ctx, func(q querier) error {
+		products = nil
+		rows, err := q.QueryContext(ctx, query)
 		if err != nil {
-			return []domain.Product{}, err
+			return err
 		}
-		products = append(products, productReturn)
-	}
-	if err = rows.Err(); err != nil {
+		defer rows.Close()
+
+		for rows.Next() {
+			var productReturn domain.Product
+			err = rows.Scan(scanProduct(&productReturn)...)
+			if err != nil {
+				return err
+			}
+			products = append(products, productReturn)
+		}
+		return rows.Err()
+	})
+	if err != nil {
 		return []domain.Product{}, err
 	}
 	return products, nil
 }
 
 // GetOne devuelve un producto por su id
-func (s *sqlStore) GetOne(id int) (domain.Product, error) {
+func (s *sqlStore) GetOne(ctx context.Context, id domain.ID) (domain.Product, error) {
 	var productReturn domain.Product
 
-	query := "SELECT * FROM products WHERE id = ?;"
-	row := s.DB.QueryRow(query, id)
-	err := row.Scan(&productReturn.Id, &productReturn.Name, &productReturn.Quantity, &productReturn.CodeValue, &productReturn.IsPublished, &productReturn.Expiration, &productReturn.Price)
-
+	query := s.dialect.rebind("SELECT " + productColumns + " FROM products WHERE id = ? AND deleted_at IS NULL")
+	err := s.read(ctx, func(q querier) error {
+		return q.QueryRowContext(ctx, query, id).Scan(scanProduct(&productReturn)...)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Product{}, ErrNotFound
+	}
 	if err != nil {
 		return domain.Product{}, err
 	}
 	return productReturn, nil
 }
 
-// AddOne agrega un nuevo producto
-func (s *sqlStore) AddOne(product domain.Product) (domain.Product, error) {
-	stmt, err := s.DB.Prepare("INSERT INTO products(name, quantity, code_value, is_published, expiration, price) VALUES( ?, ?, ?, ?, ?, ?)")
+// Find traduce la consulta a un SELECT con parametros
+func (s *sqlStore) Find(ctx context.Context, q Query) ([]domain.Product, error) {
+	where, args, err := q.sqlWhere(s.dialect)
 	if err != nil {
-		fmt.Println(err)
-		return domain.Product{}, err
+		return nil, err
 	}
-	defer stmt.Close()
-	var result sql.Result
-	date, err := time.Parse("2006-01-02", product.Expiration)
+	query := s.dialect.rebind("SELECT " + productColumns + " FROM products" + where)
+	var products []domain.Product
+	err = s.read(ctx, func(q querier) error {
+		products = []domain.Product{}
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var product domain.Product
+			if err = rows.Scan(scanProduct(&product)...); err != nil {
+				return err
+			}
+			products = append(products, product)
+		}
+		return rows.Err()
+	})
 	if err != nil {
-		fmt.Println("aca 2")
-		return domain.Product{}, err
+		return nil, err
 	}
-	result, err = stmt.Exec(product.Name, product.Quantity, product.CodeValue, product.IsPublished, date, product.Price)
+	return products, nil
+}
+
+// AddOne agrega un nuevo producto. El id y el insert van en la misma transaccion para que dos altas
+// concurrentes no lean el mismo valor de id_sequence. Si el codigo ya existe devuelve un DuplicateCodeError
+func (s *sqlStore) AddOne(ctx context.Context, product domain.Product) (domain.Product, error) {
+	err := s.WithTx(ctx, func(tx Store) error {
+		var err error
+		t := tx.(*sqlStore)
+		product.Id, err = t.newID(ctx)
+		if err != nil {
+			return err
+		}
+		product.Version = 1
+		product.DeletedAt = nil
+		query := t.dialect.rebind("INSERT INTO products(" + productColumns + ") VALUES" + productRow)
+		_, err = t.execProduct(ctx, product.Id, product.CodeValue, query, insertArgs(product)...)
+		return err
+	})
 	if err != nil {
-		fmt.Println("aca 3")
 		return domain.Product{}, err
 	}
-	insertedId, _ := result.LastInsertId()
-	product.Id = int(insertedId)
 	return product, nil
 }
 
-// UpdateOne actualiza un producto
-func (s *sqlStore) UpdateOne(product domain.Product) error {
-	p, err := s.GetOne(product.Id)
-	productUpdated, err := s.completeEmptyAttributes(p, product)
+// UpdateOne actualiza un producto. Si pasaria a usar el codigo de otro producto devuelve un DuplicateCodeError
+func (s *sqlStore) UpdateOne(ctx context.Context, product domain.Product) error {
+	// la version se lee de la primaria: una replica atrasada daria un conflicto falso
+	p, err := s.GetOne(WithPrimary(ctx), product.Id)
 	if err != nil {
 		return err
 	}
-	stmt, err := s.DB.Prepare("UPDATE products(Name, Quantity, CodeValue, IsPublished, Expiration, Price) VALUES( ?, ?, ?, ?, ?, ?)")
+	productUpdated, err := updateProduct(p, product)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	date, err := time.Parse("2006-01-02", productUpdated.Expiration)
+	// la condicion sobre la version leida evita pisar un cambio hecho entre el GetOne y el UPDATE
+	query := s.dialect.rebind("UPDATE products SET name = ?, quantity = ?, code_value = ?, is_published = ?, expiration = ?, price = ?, currency = ?, version = ?, category_id = ?, variant = ? WHERE id = ? AND version = ?")
+	result, err := s.execProduct(ctx, productUpdated.Id, productUpdated.CodeValue, query, productUpdated.Name, productUpdated.Quantity, productUpdated.CodeValue, productUpdated.IsPublished, productUpdated.Expiration, productUpdated.Price.Amount, productUpdated.Price.Currency, productUpdated.Version, nullID(productUpdated.CategoryId), productUpdated.Variant, productUpdated.Id, p.Version)
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(productUpdated.Name, productUpdated.Quantity, productUpdated.CodeValue, productUpdated.IsPublished, date, productUpdated.Price)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
 	return nil
 }
 
-// DeleteOne elimina un producto
-func (s *sqlStore) DeleteOne(id int) error {
-	stmt := "DELETE FROM products WHERE id = ?"
-	_, err := s.DB.Exec(stmt, id)
+// DeleteOne marca un producto como borrado
+func (s *sqlStore) DeleteOne(ctx context.Context, id domain.ID) error {
+	stmt := s.dialect.rebind("UPDATE products SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL")
+	return s.execOne(ctx, stmt, *deletedNow(), id)
+}
+
+// Restore deshace el borrado de un producto
+func (s *sqlStore) Restore(ctx context.Context, id domain.ID) error {
+	stmt := s.dialect.rebind("UPDATE products SET deleted_at = NULL, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL")
+	return s.execOne(ctx, stmt, id)
+}
+
+// Purge elimina los productos borrados antes de before
+func (s *sqlStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	stmt := s.dialect.rebind("DELETE FROM products WHERE deleted_at IS NOT NULL AND deleted_at < ?")
+	result, err := s.q.ExecContext(ctx, stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+// execProduct ejecuta el INSERT o UPDATE del producto id y traduce la violacion del indice unico de code_value
+// en un DuplicateCodeError, y la de la clave foranea de category_id en ErrCategoryNotFound. En postgres, dentro de una transaccion, la sentencia va en un savepoint porque
+// cualquier error aborta la transaccion completa y no se podria seguir usando, ni para buscar el duplicado
+func (s *sqlStore) execProduct(ctx context.Context, id domain.ID, codeValue string, stmt string, args ...interface{}) (sql.Result, error) {
+	_, inTx := s.q.(*sql.Tx)
+	savepoint := inTx && s.dialect.Name == Postgres.Name
+	if savepoint {
+		if _, err := s.q.ExecContext(ctx, "SAVEPOINT write_product"); err != nil {
+			return nil, err
+		}
+	}
+	result, err := s.q.ExecContext(ctx, stmt, args...)
+	if err == nil {
+		if savepoint {
+			_, err = s.q.ExecContext(ctx, "RELEASE SAVEPOINT write_product")
+		}
+		return result, err
+	}
+	if isForeignKey(err) {
+		return nil, ErrCategoryNotFound
+	}
+	if !isDuplicateCode(err) {
+		return nil, err
+	}
+	if savepoint {
+		if _, err = s.q.ExecContext(ctx, "ROLLBACK TO SAVEPOINT write_product"); err != nil {
+			return nil, err
+		}
+	}
+	var owner domain.ID
+	query := s.dialect.rebind("SELECT id FROM products WHERE code_value = ? AND id <> ?")
+	if err = s.q.QueryRowContext(ctx, query, codeValue, id).Scan(&owner); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return nil, &DuplicateCodeError{CodeValue: codeValue, ConflictingId: owner}
+}
+
+// execOne ejecuta una sentencia que debe modificar una fila, y devuelve ErrNotFound si no modifico ninguna
+func (s *sqlStore) execOne(ctx context.Context, stmt string, args ...interface{}) error {
+	result, err := s.q.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
-// completeEmptyAttributes compara dos productos y se queda con los campos diferentes
-func (s *sqlStore) completeEmptyAttributes(product domain.Product, updatedProduct domain.Product) (domain.Product, error) {
-	p := product
-	if updatedProduct.Name != "" {
-		p.Name = updatedProduct.Name
+// AddMany agrega los productos en una transaccion con INSERTs de varias filas
+func (s *sqlStore) AddMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return runBatch(ctx, s, func(tx Store) ([]BatchResult, error) {
+		return tx.(*sqlStore).addMany(ctx, products)
+	})
+}
+
+// UpdateMany actualiza los productos en una transaccion, con un UPDATE por producto
+func (s *sqlStore) UpdateMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	return UpdateEach(ctx, s, products)
+}
+
+// DeleteMany borra los productos en una transaccion, con un UPDATE por producto
+func (s *sqlStore) DeleteMany(ctx context.Context, ids []domain.ID) ([]BatchResult, error) {
+	return DeleteEach(ctx, s, ids)
+}
+
+// addMany agrega los productos con INSERTs de varias filas. Los codigos que ya usa otro producto, o uno anterior
+// del mismo lote, se informan en su resultado antes de insertar. Se llama dentro de una transaccion
+func (s *sqlStore) addMany(ctx context.Context, products []domain.Product) ([]BatchResult, error) {
+	results := make([]BatchResult, len(products))
+	if len(products) == 0 {
+		return results, nil
 	}
-	if updatedProduct.Quantity != 0 {
-		p.Quantity = updatedProduct.Quantity
+	owners, err := s.codeOwners(ctx, products)
+	if err != nil {
+		return nil, err
 	}
-	if updatedProduct.CodeValue != "" {
-		p.CodeValue = updatedProduct.CodeValue
+	ids, err := s.newIDs(ctx, len(products))
+	if err != nil {
+		return nil, err
 	}
-	if updatedProduct.IsPublished {
-		p.IsPublished = updatedProduct.IsPublished
+	var rows []domain.Product
+	for i, product := range products {
+		if owner, ok := owners[product.CodeValue]; ok {
+			results[i].Err = &DuplicateCodeError{CodeValue: product.CodeValue, ConflictingId: owner}
+			continue
+		}
+		product.Id = ids[i]
+		product.Version = 1
+		product.DeletedAt = nil
+		if product.CodeValue != "" {
+			owners[product.CodeValue] = product.Id
+		}
+		results[i].Product = product
+		rows = append(rows, product)
 	}
-	if updatedProduct.Expiration != "" {
-		p.Expiration = updatedProduct.Expiration
+	perInsert := sqlMaxParams / len(insertArgs(domain.Product{}))
+	for start := 0; start < len(rows); start += perInsert {
+		end := start + perInsert
+		if end > len(rows) {
+			end = len(rows)
+		}
+		query := "INSERT INTO products(" + productColumns + ") VALUES" + strings.Repeat(productRow+", ", end-start-1) + productRow
+		var args []interface{}
+		for _, product := range rows[start:end] {
+			args = append(args, insertArgs(product)...)
+		}
+		if _, err = s.q.ExecContext(ctx, s.dialect.rebind(query), args...); isForeignKey(err) {
+			return nil, ErrCategoryNotFound
+		} else if err != nil {
+			return nil, err
+		}
 	}
-	if updatedProduct.Price != 0.0 {
-		p.Price = updatedProduct.Price
+	return results, nil
+}
+
+// codeOwners devuelve el id del producto, borrado o no, que usa cada codigo no vacio de products
+func (s *sqlStore) codeOwners(ctx context.Context, products []domain.Product) (map[string]domain.ID, error) {
+	var codes []interface{}
+	for _, product := range products {
+		if product.CodeValue != "" {
+			codes = append(codes, product.CodeValue)
+		}
+	}
+	owners := map[string]domain.ID{}
+	for start := 0; start < len(codes); start += sqlMaxParams {
+		end := start + sqlMaxParams
+		if end > len(codes) {
+			end = len(codes)
+		}
+		query := "SELECT id, code_value FROM products WHERE code_value IN (" + strings.Repeat("?, ", end-start-1) + "?)"
+		rows, err := s.q.QueryContext(ctx, s.dialect.rebind(query), codes[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id domain.ID
+			var code string
+			if err = rows.Scan(&id, &code); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			owners[code] = id
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return owners, nil
+}
+
+// insertArgs devuelve los valores de productRow para un producto
+func insertArgs(product domain.Product) []interface{} {
+	return []interface{}{product.Id, product.Name, product.Quantity, product.CodeValue, product.IsPublished, product.Expiration, product.Price.Amount, product.Price.Currency, product.Version, nullID(product.CategoryId), nullID(product.ParentId), product.Variant}
+}
+
+type snapshotKey struct{}
+
+// WithSnapshot marca el contexto para que WithTx abra una transaccion de solo lectura REPEATABLE READ, en la que
+// todas las lecturas ven el mismo estado. Con el nivel por defecto de Postgres (READ COMMITTED) cada sentencia
+// ve los cambios ya confirmados por otras transacciones
+func WithSnapshot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, true)
+}
+
+// txOptions devuelve las opciones de la transaccion que pide el contexto; nil es el nivel por defecto de la base
+func txOptions(ctx context.Context) *sql.TxOptions {
+	if snapshot, _ := ctx.Value(snapshotKey{}).(bool); snapshot {
+		return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	return nil
+}
+
+// WithTx ejecuta fn dentro de una transaccion de la base, con las opciones que pida el contexto (WithSnapshot)
+func (s *sqlStore) WithTx(ctx context.Context, fn func(tx Store) error) (err error) {
+	if _, ok := s.q.(*sql.Tx); ok {
+		return fn(s)
 	}
-	return p, nil
+	tx, err := s.DB.BeginTx(ctx, txOptions(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return fn(&sqlStore{DB: s.DB, dialect: s.dialect, gen: s.gen, q: tx})
+}
+
+// newID devuelve un id del generador configurado o, si no hay, incrementa la secuencia de la tabla id_sequence
+// (creada por la migracion 0002) dentro de la misma transaccion que el insert
+func (s *sqlStore) newID(ctx context.Context) (domain.ID, error) {
+	if s.gen != nil {
+		return s.gen.NewID(ctx)
+	}
+	value, err := nextSequence(ctx, s.q, s.dialect, "products", 1)
+	if err != nil {
+		return "", err
+	}
+	return domain.IntID(value), nil
+}
+
+// newIDs devuelve n ids nuevos; sin generador reserva los n valores de id_sequence con un solo UPDATE
+func (s *sqlStore) newIDs(ctx context.Context, n int) ([]domain.ID, error) {
+	ids := make([]domain.ID, n)
+	if s.gen != nil {
+		for i := range ids {
+			id, err := s.gen.NewID(ctx)
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = id
+		}
+		return ids, nil
+	}
+	last, err := nextSequence(ctx, s.q, s.dialect, "products", int64(n))
+	if err != nil {
+		return nil, err
+	}
+	for i := range ids {
+		ids[i] = domain.IntID(last - int64(n-1-i))
+	}
+	return ids, nil
+}
+
+// nextSequence incrementa en count la secuencia name de id_sequence y devuelve su nuevo valor; q debe ser
+// una transaccion para que dos altas concurrentes no lean el mismo valor
+func nextSequence(ctx context.Context, q querier, dialect Dialect, name string, count int64) (int64, error) {
+	result, err := q.ExecContext(ctx, dialect.rebind("UPDATE id_sequence SET value = value + ? WHERE name = ?"), count, name)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, errors.New("id sequence not initialized, run the migrations")
+	}
+	var value int64
+	err = q.QueryRowContext(ctx, dialect.rebind("SELECT value FROM id_sequence WHERE name = ?"), name).Scan(&value)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// SyncIDSequence adelanta la secuencia de id_sequence hasta el mayor id numerico de products, para que las
+// altas posteriores a una carga con ids propios (ej. el comando copy) no repitan ids
+func SyncIDSequence(ctx context.Context, db *sql.DB, dialect Dialect) error {
+	rows, err := db.QueryContext(ctx, "SELECT id FROM products")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var max int64
+	for rows.Next() {
+		var id domain.ID
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		if n, ok := id.Int(); ok && n > max {
+			max = n
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, dialect.rebind("UPDATE id_sequence SET value = ? WHERE name = ? AND value < ?"), max, "products", max)
+	return err
+}
+
+// scanProduct devuelve los destinos de Scan en el orden de productColumns
+func scanProduct(p *domain.Product) []interface{} {
+	return []interface{}{&p.Id, &p.Name, &p.Quantity, &p.CodeValue, &p.IsPublished, &p.Expiration, &p.Price.Amount, &p.Price.Currency, &p.Version, idColumn{&p.CategoryId}, idColumn{&p.ParentId}, &p.Variant, timeColumn{&p.DeletedAt}}
+}
+
+// nullID guarda un id vacio como NULL, para las columnas que referencian a otra fila de forma opcional
+func nullID(id domain.ID) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+// idColumn lee una columna de id que puede ser NULL, que se lee como id vacio
+type idColumn struct {
+	dest *domain.ID
+}
+
+// Scan implementa sql.Scanner
+func (c idColumn) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c.dest = ""
+	case []byte:
+		*c.dest = domain.ID(v)
+	case string:
+		*c.dest = domain.ID(v)
+	case int64:
+		*c.dest = domain.IntID(v)
+	default:
+		return fmt.Errorf("unsupported id type %T", src)
+	}
+	return nil
+}
+
+// timeColumn lee una columna de fecha y hora que puede ser NULL, como time.Time o como texto segun el driver
+type timeColumn struct {
+	dest **time.Time
+}
+
+// Scan implementa sql.Scanner
+func (t timeColumn) Scan(src interface{}) error {
+	var value time.Time
+	switch v := src.(type) {
+	case nil:
+		*t.dest = nil
+		return nil
+	case time.Time:
+		value = v
+	case []byte, string:
+		text := fmt.Sprintf("%s", v)
+		if len(text) > len("2006-01-02 15:04:05") {
+			text = text[:len("2006-01-02 15:04:05")]
+		}
+		parsed, err := time.Parse("2006-01-02 15:04:05", text)
+		if err != nil {
+			return fmt.Errorf("invalid deleted_at %q: %w", v, err)
+		}
+		value = parsed
+	default:
+		return fmt.Errorf("unsupported deleted_at type %T", src)
+	}
+	value = value.UTC()
+	*t.dest = &value
+	return nil
 }
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"clase19/pkg/migrate"
+	"database/sql"
+)
+
+// NewSqliteStore crea un nuevo store de products sobre una base sqlite y aplica las migraciones pendientes
+func NewSqliteStore(db *sql.DB, gen IDGenerator) (Store, error) {
+	migrator, err := migrate.New(db, SQLite.Name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = migrator.Up(); err != nil {
+		return nil, err
+	}
+	// sqlite admite un solo escritor: con una unica conexion las transacciones esperan su turno en lugar de fallar con "database is locked"
+	db.SetMaxOpenConns(1)
+	// sqlite controla las claves foraneas, como la de products.category_id, solo si la conexion lo activa
+	if _, err = db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		return nil, err
+	}
+	return NewSqlStore(db, SQLite, gen), nil
+}
@@ -0,0 +1,290 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/migrate"
+	"clase19/pkg/store"
+	"clase19/pkg/store/storetest"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		return store.NewMemoryStore(nil, nil), func() {}, nil
+	})
+}
+
+func TestJsonStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		path := filepath.Join(t.TempDir(), "products.json")
+		if err := os.WriteFile(path, []byte("[]"), 0644); err != nil {
+			return nil, nil, err
+		}
+		return store.NewJsonStore(path, nil), func() {}, nil
+	})
+}
+
+func TestJournalStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		s, err := store.NewJournalStore(filepath.Join(t.TempDir(), "products.json"), 5, nil)
+		return s, func() {}, err
+	})
+}
+
+func TestEventStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		s, err := store.NewEventStore(filepath.Join(t.TempDir(), "products.events"), "", 5, nil)
+		return s, func() {}, err
+	})
+}
+
+func TestBoltStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		s, err := store.NewBoltStore(filepath.Join(t.TempDir(), "products.bolt"), "", nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() { s.(io.Closer).Close() }, nil
+	})
+}
+
+func TestSqliteStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		db, err := sql.Open(store.SQLite.Driver, filepath.Join(t.TempDir(), "products.db"))
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := store.NewSqliteStore(db, nil)
+		if err == nil {
+			err = seedCategories(db)
+		}
+		return s, func() { db.Close() }, err
+	})
+}
+
+// seedCategories crea las categorias que usan los casos de storetest, que la clave foranea de
+// products.category_id exige en las bases sql
+func seedCategories(db *sql.DB) error {
+	_, err := db.Exec("INSERT INTO categories(id, name) VALUES('1', 'one'), ('2', 'two'), ('3', 'three')")
+	return err
+}
+
+// TestSqlitePrices comprueba que sqlite guarde el precio como texto, sin pasar por REAL
+func TestSqlitePrices(t *testing.T) {
+	db, err := sql.Open(store.SQLite.Driver, filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, err := store.NewSqliteStore(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := domain.Product{Name: "exact", Quantity: 1, CodeValue: "EXACT1", Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(999999999999, domain.DefaultCurrency)}
+	added, err := s.AddOne(context.Background(), product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kind, price string
+	if err = db.QueryRow("SELECT typeof(price), price FROM products WHERE id = ?", added.Id).Scan(&kind, &price); err != nil {
+		t.Fatal(err)
+	}
+	if kind != "text" || price != "9999999999.99" {
+		t.Fatalf("price stored as %s %q, want text 9999999999.99", kind, price)
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		return store.NewCachedStore(store.NewMemoryStore(nil, nil), time.Minute, 0), func() {}, nil
+	})
+}
+
+func TestHistoryStore(t *testing.T) {
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		db, err := sql.Open(store.SQLite.Driver, filepath.Join(t.TempDir(), "history.db"))
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := store.NewSqliteStore(db, nil)
+		if err == nil {
+			err = seedCategories(db)
+		}
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return store.NewHistoryStore(s, store.NewSqlHistory(db, store.SQLite)), func() { db.Close() }, nil
+	})
+}
+
+// TestHistoryAtomic comprueba que con el historial en la misma base un cambio que no se puede registrar no se guarde
+func TestHistoryAtomic(t *testing.T) {
+	db, err := sql.Open(store.SQLite.Driver, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	next, err := store.NewSqliteStore(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.NewHistoryStore(next, store.NewSqlHistory(db, store.SQLite))
+	if _, err = db.Exec("DROP TABLE product_history"); err != nil {
+		t.Fatal(err)
+	}
+	product := domain.Product{Name: "unlogged", Quantity: 1, CodeValue: "UNLOGGED1", Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(100, domain.DefaultCurrency)}
+	if _, err = s.AddOne(context.Background(), product); err == nil {
+		t.Fatal("add succeeded without a history table")
+	}
+	products, err := next.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 0 {
+		t.Fatalf("add without history left %d products", len(products))
+	}
+}
+
+// TestSqliteCategoryKey comprueba que la clave foranea de category_id impida borrar una categoria en uso y
+// guardar un producto con una categoria que no existe
+func TestSqliteCategoryKey(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(store.SQLite.Driver, filepath.Join(t.TempDir(), "products.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, err := store.NewSqliteStore(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories := store.NewSqlCategories(db, store.SQLite)
+	used, err := categories.Add(ctx, domain.Category{Name: "used"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := domain.Product{Name: "keyed", Quantity: 1, CodeValue: "KEYED1", Expiration: domain.NewDate(2030, time.January, 1), Price: domain.NewMoney(100, domain.DefaultCurrency), CategoryId: used.Id}
+	added, err := s.AddOne(ctx, product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = categories.Delete(ctx, used.Id); !errors.Is(err, store.ErrCategoryInUse) {
+		t.Fatalf("deleting a used category returned %v, want ErrCategoryInUse", err)
+	}
+	product.CodeValue, product.CategoryId = "KEYED2", "999"
+	if _, err = s.AddOne(ctx, product); !errors.Is(err, store.ErrCategoryNotFound) {
+		t.Fatalf("adding a product with a missing category returned %v, want ErrCategoryNotFound", err)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, CategoryId: "999"}); !errors.Is(err, store.ErrCategoryNotFound) {
+		t.Fatalf("moving a product to a missing category returned %v, want ErrCategoryNotFound", err)
+	}
+	product.CodeValue = "KEYED3"
+	if _, err = s.AddMany(ctx, []domain.Product{product}); !errors.Is(err, store.ErrCategoryNotFound) {
+		t.Fatalf("adding a batch with a missing category returned %v, want ErrCategoryNotFound", err)
+	}
+}
+
+// TestSeedVersions comprueba que los productos de un products.json sin version se lean con version 1
+func TestSeedVersions(t *testing.T) {
+	seed := []byte(`[{"id": 1, "name": "seeded", "quantity": 1, "code_value": "SEED1", "expiration": "15/12/2021", "price": 71.42}]`)
+	stores := map[string]func(path string) (store.Store, error){
+		"memory": func(path string) (store.Store, error) {
+			return store.NewMemoryStoreFromFile(path, nil)
+		},
+		"json": func(path string) (store.Store, error) {
+			return store.NewJsonStore(path, nil), nil
+		},
+		"journal": func(path string) (store.Store, error) {
+			return store.NewJournalStore(path, 5, nil)
+		},
+		"events": func(path string) (store.Store, error) {
+			return store.NewEventStore(path+".events", path, 5, nil)
+		},
+		"bolt": func(path string) (store.Store, error) {
+			return store.NewBoltStore(path+".bolt", path, nil)
+		},
+	}
+	for name, open := range stores {
+		open := open
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "products.json")
+			if err := os.WriteFile(path, seed, 0644); err != nil {
+				t.Fatal(err)
+			}
+			s, err := open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if closer, ok := s.(io.Closer); ok {
+				defer closer.Close()
+			}
+			product, err := s.GetOne(context.Background(), "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if product.Version != 1 {
+				t.Fatalf("seeded product has version %d, want 1", product.Version)
+			}
+		})
+	}
+}
+
+// TestMysqlStore corre contra la base de STORETEST_MYSQL_DSN, borrando sus productos antes de cada caso
+func TestMysqlStore(t *testing.T) {
+	runSqlTest(t, "STORETEST_MYSQL_DSN")
+}
+
+// TestPostgresStore corre contra la base de STORETEST_POSTGRES_DSN, borrando sus productos antes de cada caso
+func TestPostgresStore(t *testing.T) {
+	runSqlTest(t, "STORETEST_POSTGRES_DSN")
+}
+
+// runSqlTest abre la base del DSN de la variable env, aplica las migraciones y la vacia para cada caso, dejando
+// solo las categorias de seedCategories
+func runSqlTest(t *testing.T, env string) {
+	url := os.Getenv(env)
+	if url == "" {
+		t.Skipf("%s not set", env)
+	}
+	storetest.RunTest(t, func() (store.Store, func(), error) {
+		dialect, dsn, err := store.ParseDSN(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		db, err := sql.Open(dialect.Driver, dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		migrator, err := migrate.New(db, dialect.Name)
+		if err == nil {
+			_, err = migrator.Up()
+		}
+		if err == nil {
+			_, err = db.Exec("DELETE FROM products")
+		}
+		if err == nil {
+			_, err = db.Exec("DELETE FROM categories")
+		}
+		if err == nil {
+			err = seedCategories(db)
+		}
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		return store.NewSqlStore(db, dialect, nil), func() { db.Close() }, nil
+	})
+}
@@ -0,0 +1,637 @@
+// Package storetest es una bateria de pruebas de comportamiento que todo store.Store debe cumplir.
+// Se corre desde los tests de cada store con RunTest.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/store"
+)
+
+// Factory crea un store vacio para un caso y devuelve la funcion que lo libera
+type Factory func() (store.Store, func(), error)
+
+// Case es una prueba de la bateria; devuelve error si el store no se comporta como se espera
+type Case struct {
+	Name string
+	Run  func(ctx context.Context, s store.Store) error
+}
+
+// Cases son todas las pruebas de la bateria
+var Cases = []Case{
+	{"ids", testIDs},
+	{"not_found", testNotFound},
+	{"partial_update", testPartialUpdate},
+	{"delete", testDelete},
+	{"concurrency", testConcurrency},
+	{"dates", testDates},
+	{"money", testMoney},
+	{"categories", testCategories},
+	{"variants", testVariants},
+	{"find", testFind},
+	{"tx_rollback", testTxRollback},
+	{"versions", testVersions},
+	{"soft_delete", testSoftDelete},
+	{"batch", testBatch},
+	{"unique_code", testUniqueCode},
+}
+
+// RunTest corre todos los casos como subtests de t, cada uno sobre un store nuevo
+func RunTest(t *testing.T, newStore Factory) {
+	for _, c := range Cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := runCase(context.Background(), newStore, c); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// runCase crea el store, corre el caso y lo libera
+func runCase(ctx context.Context, newStore Factory, c Case) error {
+	s, release, err := newStore()
+	if err != nil {
+		return fmt.Errorf("creating store: %w", err)
+	}
+	defer release()
+	return c.Run(ctx, s)
+}
+
+// sample devuelve un producto valido distinto para cada n
+func sample(n int) domain.Product {
+	return domain.Product{
+		Name:        fmt.Sprintf("product %d", n),
+		Quantity:    n + 1,
+		CodeValue:   fmt.Sprintf("CODE%d", n),
+		IsPublished: true,
+		Expiration:  domain.NewDate(2024, time.January, 2),
+		Price:       domain.NewMoney(domain.Amount(n*100+50), domain.DefaultCurrency),
+	}
+}
+
+// testIDs comprueba que AddOne asigne ids unicos y que GetOne devuelva lo mismo que se guardo
+func testIDs(ctx context.Context, s store.Store) error {
+	seen := map[domain.ID]bool{}
+	for i := 0; i < 3; i++ {
+		added, err := s.AddOne(ctx, sample(i))
+		if err != nil {
+			return err
+		}
+		if added.Id == "" || seen[added.Id] {
+			return fmt.Errorf("AddOne assigned id %q, want a new non empty id", added.Id)
+		}
+		seen[added.Id] = true
+		got, err := s.GetOne(ctx, added.Id)
+		if err != nil {
+			return err
+		}
+		if got != added {
+			return fmt.Errorf("GetOne(%s) = %+v, want %+v", added.Id, got, added)
+		}
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != 3 {
+		return fmt.Errorf("GetAll returned %d products, want 3", len(all))
+	}
+	return nil
+}
+
+// testNotFound comprueba que todas las operaciones sobre un id inexistente devuelvan store.ErrNotFound
+func testNotFound(ctx context.Context, s store.Store) error {
+	missing := domain.ID("999999")
+	if _, err := s.GetOne(ctx, missing); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("GetOne of a missing id returned %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateOne(ctx, domain.Product{Id: missing, Name: "x"}); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("UpdateOne of a missing id returned %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteOne(ctx, missing); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("DeleteOne of a missing id returned %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+// testPartialUpdate comprueba que UpdateOne solo cambie los campos informados
+func testPartialUpdate(ctx context.Context, s store.Store) error {
+	added, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "renamed"}); err != nil {
+		return err
+	}
+	got, err := s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	want := added
+	want.Name = "renamed"
+	want.Version++
+	if got != want {
+		return fmt.Errorf("after a partial update got %+v, want %+v", got, want)
+	}
+	return nil
+}
+
+// testDelete comprueba que un producto borrado desaparezca sin afectar al resto
+func testDelete(ctx context.Context, s store.Store) error {
+	first, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	second, err := s.AddOne(ctx, sample(2))
+	if err != nil {
+		return err
+	}
+	if err = s.DeleteOne(ctx, first.Id); err != nil {
+		return err
+	}
+	if _, err = s.GetOne(ctx, first.Id); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("GetOne of a deleted product returned %v, want ErrNotFound", err)
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != 1 || all[0].Id != second.Id {
+		return fmt.Errorf("GetAll after delete returned %+v, want only %s", all, second.Id)
+	}
+	return nil
+}
+
+// testConcurrency comprueba que altas concurrentes no pierdan productos ni repitan ids
+func testConcurrency(ctx context.Context, s store.Store) error {
+	const n = 20
+	var wg sync.WaitGroup
+	ids := make([]domain.ID, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			added, err := s.AddOne(ctx, sample(i))
+			ids[i], errs[i] = added.Id, err
+		}(i)
+	}
+	wg.Wait()
+	seen := map[domain.ID]bool{}
+	for i := range ids {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if seen[ids[i]] {
+			return fmt.Errorf("concurrent AddOne repeated id %s", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != n {
+		return fmt.Errorf("GetAll after %d concurrent adds returned %d products", n, len(all))
+	}
+	return nil
+}
+
+// testDates comprueba que la fecha de expiracion vuelva igual a como se guardo y que se pueda filtrar por ella
+func testDates(ctx context.Context, s store.Store) error {
+	p := sample(1)
+	p.Expiration = domain.NewDate(2031, time.December, 9)
+	added, err := s.AddOne(ctx, p)
+	if err != nil {
+		return err
+	}
+	if added.Expiration != p.Expiration {
+		return fmt.Errorf("AddOne returned expiration %q, want %q", added.Expiration, p.Expiration)
+	}
+	got, err := s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	if got.Expiration != p.Expiration {
+		return fmt.Errorf("GetOne returned expiration %q, want %q", got.Expiration, p.Expiration)
+	}
+	updated := domain.NewDate(2032, time.January, 31)
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Expiration: updated}); err != nil {
+		return err
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != 1 || all[0].Expiration != updated {
+		return fmt.Errorf("GetAll after updating the expiration returned %+v", all)
+	}
+	for _, f := range []struct {
+		op    store.Operator
+		value domain.Date
+		want  int
+	}{{store.Eq, updated, 1}, {store.Gt, updated, 0}, {store.Lt, domain.NewDate(2032, time.February, 1), 1}} {
+		found, err := s.Find(ctx, store.Query{}.Where("expiration", f.op, f.value))
+		if err != nil {
+			return err
+		}
+		if len(found) != f.want {
+			return fmt.Errorf("Find expiration %s %s returned %d products, want %d", f.op, f.value, len(found), f.want)
+		}
+	}
+	return nil
+}
+
+// testMoney comprueba que el precio vuelva exacto y con su moneda, y que se pueda cambiar solo la moneda
+func testMoney(ctx context.Context, s store.Store) error {
+	p := sample(1)
+	p.Price = domain.NewMoney(1234567, "USD")
+	added, err := s.AddOne(ctx, p)
+	if err != nil {
+		return err
+	}
+	got, err := s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	if got.Price != p.Price {
+		return fmt.Errorf("GetOne returned price %s, want %s", got.Price, p.Price)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Price: domain.Money{Currency: "EUR"}}); err != nil {
+		return err
+	}
+	got, err = s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	if want := domain.NewMoney(1234567, "EUR"); got.Price != want {
+		return fmt.Errorf("GetOne after updating the currency returned price %s, want %s", got.Price, want)
+	}
+	return nil
+}
+
+// testCategories comprueba que se guarde la categoria de los productos y que se pueda filtrar por ella
+func testCategories(ctx context.Context, s store.Store) error {
+	var added []domain.Product
+	for i, category := range []domain.ID{"1", "2", "", "3"} {
+		p := sample(i)
+		p.CategoryId = category
+		p, err := s.AddOne(ctx, p)
+		if err != nil {
+			return err
+		}
+		added = append(added, p)
+	}
+	got, err := s.GetOne(ctx, added[1].Id)
+	if err != nil {
+		return err
+	}
+	if got.CategoryId != "2" {
+		return fmt.Errorf("GetOne returned category %q, want 2", got.CategoryId)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added[2].Id, CategoryId: "3"}); err != nil {
+		return err
+	}
+	got, err = s.GetOne(ctx, added[2].Id)
+	if err != nil {
+		return err
+	}
+	if got.CategoryId != "3" {
+		return fmt.Errorf("GetOne after updating the category returned %q, want 3", got.CategoryId)
+	}
+	products, err := s.Find(ctx, store.Query{}.Where("category_id", store.In, []domain.ID{"1", "3"}).OrderBy("id", false))
+	if err != nil {
+		return err
+	}
+	if len(products) != 3 || products[0].Id != added[0].Id || products[1].Id != added[2].Id || products[2].Id != added[3].Id {
+		return fmt.Errorf("Find by category returned %d products, want %s, %s and %s", len(products), added[0].Id, added[2].Id, added[3].Id)
+	}
+	return nil
+}
+
+// testVariants comprueba que se guarden el producto padre y el nombre de las variantes, y que el padre no cambie
+func testVariants(ctx context.Context, s store.Store) error {
+	parent, err := s.AddOne(ctx, sample(0))
+	if err != nil {
+		return err
+	}
+	var added []domain.Product
+	for i, name := range []string{"750 ml", "pack x6"} {
+		p := sample(i + 1)
+		p.ParentId, p.Variant = parent.Id, name
+		p, err := s.AddOne(ctx, p)
+		if err != nil {
+			return err
+		}
+		added = append(added, p)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added[1].Id, ParentId: added[0].Id, Variant: "pack x12"}); err != nil {
+		return err
+	}
+	got, err := s.GetOne(ctx, added[1].Id)
+	if err != nil {
+		return err
+	}
+	if got.ParentId != parent.Id || got.Variant != "pack x12" {
+		return fmt.Errorf("GetOne after update returned parent %q and variant %q, want %s and pack x12", got.ParentId, got.Variant, parent.Id)
+	}
+	variants, err := s.Find(ctx, store.Query{}.Where("parent_id", store.Eq, parent.Id).OrderBy("id", false))
+	if err != nil {
+		return err
+	}
+	if len(variants) != 2 || variants[0].Id != added[0].Id || variants[0].Variant != "750 ml" || variants[1].Id != added[1].Id {
+		return fmt.Errorf("Find by parent returned %d products, want %s and %s", len(variants), added[0].Id, added[1].Id)
+	}
+	return nil
+}
+
+// testFind comprueba filtros, orden y paginado
+func testFind(ctx context.Context, s store.Store) error {
+	var added []domain.Product
+	for i := 0; i < 5; i++ {
+		p, err := s.AddOne(ctx, sample(i))
+		if err != nil {
+			return err
+		}
+		added = append(added, p)
+	}
+	q := store.Query{Limit: 2, Offset: 1}.Where("price", store.Gt, domain.Amount(100)).OrderBy("price", true)
+	got, err := s.Find(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(got) != 2 || got[0].Id != added[3].Id || got[1].Id != added[2].Id {
+		return fmt.Errorf("Find returned %+v, want products %s and %s", got, added[3].Id, added[2].Id)
+	}
+	got, err = s.Find(ctx, store.Query{}.Where("code_value", store.In, []string{"CODE0", "CODE4", "OTHER"}).OrderBy("id", false))
+	if err != nil {
+		return err
+	}
+	if len(got) != 2 || got[0].Id != added[0].Id || got[1].Id != added[4].Id {
+		return fmt.Errorf("Find by code_value returned %+v, want products %s and %s", got, added[0].Id, added[4].Id)
+	}
+	if _, err = s.Find(ctx, store.Query{}.Where("unknown", store.Eq, 1)); err == nil {
+		return errors.New("Find accepted an unknown field")
+	}
+	return nil
+}
+
+// testTxRollback comprueba que WithTx no aplique nada si fn devuelve error
+func testTxRollback(ctx context.Context, s store.Store) error {
+	added, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	failed := errors.New("rollback")
+	err = s.WithTx(ctx, func(tx store.Store) error {
+		if _, err := tx.AddOne(ctx, sample(2)); err != nil {
+			return err
+		}
+		if err := tx.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "changed"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		return fmt.Errorf("WithTx returned %v, want the error of fn", err)
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != 1 || all[0] != added {
+		return fmt.Errorf("after a failed WithTx GetAll returned %+v, want only %+v", all, added)
+	}
+	return nil
+}
+
+// testVersions comprueba que las altas empiecen en la version 1, que cada cambio la incremente
+// y que una actualizacion con una version vieja se rechace sin modificar el producto
+func testVersions(ctx context.Context, s store.Store) error {
+	added, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	if added.Version != 1 {
+		return fmt.Errorf("AddOne returned version %d, want 1", added.Version)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "first", Version: 1}); err != nil {
+		return err
+	}
+	err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "stale", Version: 1})
+	if !errors.Is(err, store.ErrVersionConflict) {
+		return fmt.Errorf("UpdateOne with a stale version returned %v, want ErrVersionConflict", err)
+	}
+	got, err := s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	if got.Name != "first" || got.Version != 2 {
+		return fmt.Errorf("after a rejected update got %+v, want name first and version 2", got)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "any"}); err != nil {
+		return err
+	}
+	if got, err = s.GetOne(ctx, added.Id); err != nil {
+		return err
+	}
+	if got.Version != 3 {
+		return fmt.Errorf("an update without version left version %d, want 3", got.Version)
+	}
+	// una actualizacion sin cambios igual avanza la version, y la version guardada tiene que seguirla
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Version: 3}); err != nil {
+		return err
+	}
+	if got, err = s.GetOne(ctx, added.Id); err != nil {
+		return err
+	}
+	if got.Version != 4 {
+		return fmt.Errorf("an update without changes left version %d, want 4", got.Version)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "last", Version: 4}); err != nil {
+		return fmt.Errorf("update after an update without changes: %w", err)
+	}
+	return nil
+}
+
+// testSoftDelete comprueba que un producto borrado quede oculto pero recuperable, y que Purge solo elimine
+// los borrados antes de la fecha indicada
+func testSoftDelete(ctx context.Context, s store.Store) error {
+	added, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	if err = s.DeleteOne(ctx, added.Id); err != nil {
+		return err
+	}
+	if err = s.DeleteOne(ctx, added.Id); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("deleting twice returned %v, want ErrNotFound", err)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: added.Id, Name: "x"}); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("UpdateOne of a deleted product returned %v, want ErrNotFound", err)
+	}
+	if got, err := s.Find(ctx, store.Query{}); err != nil || len(got) != 0 {
+		return fmt.Errorf("Find returned %+v, %v, want no products", got, err)
+	}
+	got, err := s.Find(ctx, store.Query{IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	if len(got) != 1 || got[0].DeletedAt == nil {
+		return fmt.Errorf("Find with IncludeDeleted returned %+v, want the deleted product", got)
+	}
+	if err = s.Restore(ctx, added.Id); err != nil {
+		return err
+	}
+	if err = s.Restore(ctx, added.Id); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("restoring a product that is not deleted returned %v, want ErrNotFound", err)
+	}
+	restored, err := s.GetOne(ctx, added.Id)
+	if err != nil {
+		return err
+	}
+	if restored.DeletedAt != nil || restored.Name != added.Name {
+		return fmt.Errorf("after Restore got %+v", restored)
+	}
+	if err = s.DeleteOne(ctx, added.Id); err != nil {
+		return err
+	}
+	if purged, err := s.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		return fmt.Errorf("Purge of an older date returned %d, %v, want 0", purged, err)
+	}
+	if purged, err := s.Purge(ctx, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+		return fmt.Errorf("Purge returned %d, %v, want 1", purged, err)
+	}
+	if err = s.Restore(ctx, added.Id); !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("restoring a purged product returned %v, want ErrNotFound", err)
+	}
+	return nil
+}
+
+// testBatch comprueba que las operaciones en lote guarden los productos validos e informen por producto
+// los que no existen o tienen una version vieja
+func testBatch(ctx context.Context, s store.Store) error {
+	added, err := s.AddMany(ctx, []domain.Product{sample(1), sample(2), sample(3)})
+	if err != nil {
+		return err
+	}
+	if len(added) != 3 {
+		return fmt.Errorf("AddMany returned %d results, want 3", len(added))
+	}
+	for _, result := range added {
+		if result.Err != nil || result.Product.Id == "" || result.Product.Version != 1 {
+			return fmt.Errorf("AddMany returned %+v, want a new product", result)
+		}
+	}
+	updated, err := s.UpdateMany(ctx, []domain.Product{
+		{Id: added[0].Product.Id, Name: "renamed", Version: 1},
+		{Id: added[1].Product.Id, Name: "stale", Version: 5},
+		{Id: "999999", Name: "missing"},
+	})
+	if err != nil {
+		return err
+	}
+	if updated[0].Err != nil || updated[0].Product.Name != "renamed" || updated[0].Product.Version != 2 {
+		return fmt.Errorf("UpdateMany returned %+v for a valid update", updated[0])
+	}
+	if !errors.Is(updated[1].Err, store.ErrVersionConflict) {
+		return fmt.Errorf("UpdateMany with a stale version returned %v, want ErrVersionConflict", updated[1].Err)
+	}
+	if !errors.Is(updated[2].Err, store.ErrNotFound) {
+		return fmt.Errorf("UpdateMany of a missing id returned %v, want ErrNotFound", updated[2].Err)
+	}
+	deleted, err := s.DeleteMany(ctx, []domain.ID{added[1].Product.Id, "999999"})
+	if err != nil {
+		return err
+	}
+	if deleted[0].Err != nil || !errors.Is(deleted[1].Err, store.ErrNotFound) {
+		return fmt.Errorf("DeleteMany returned %+v, want the first deleted and the second not found", deleted)
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(all) != 2 {
+		return fmt.Errorf("after the batches GetAll returned %d products, want 2", len(all))
+	}
+	// un lote mas largo que una sentencia, con un codigo que ya existe y otro repetido dentro del lote
+	batch := make([]domain.Product, 200)
+	for i := range batch {
+		batch[i] = sample(10 + i)
+	}
+	batch[50] = sample(1)
+	batch[150] = sample(10)
+	owner := added[0].Product.Id
+	added, err = s.AddMany(ctx, batch)
+	if err != nil {
+		return err
+	}
+	var duplicate *store.DuplicateCodeError
+	if !errors.As(added[50].Err, &duplicate) || duplicate.ConflictingId != owner {
+		return fmt.Errorf("AddMany of an existing code returned %v, want ErrDuplicateCode with product %s", added[50].Err, owner)
+	}
+	if !errors.As(added[150].Err, &duplicate) || duplicate.ConflictingId != added[0].Product.Id {
+		return fmt.Errorf("AddMany of a code repeated in the batch returned %v, want ErrDuplicateCode with product %s", added[150].Err, added[0].Product.Id)
+	}
+	for _, i := range []int{0, 99, 199} {
+		got, err := s.GetOne(ctx, added[i].Product.Id)
+		if err != nil {
+			return fmt.Errorf("product %d of the batch: %w", i, err)
+		}
+		if got != added[i].Product {
+			return fmt.Errorf("product %d of the batch is %+v, AddMany returned %+v", i, got, added[i].Product)
+		}
+	}
+	if all, err = s.GetAll(ctx); err != nil {
+		return err
+	}
+	if len(all) != 200 {
+		return fmt.Errorf("after the long batch GetAll returned %d products, want 200", len(all))
+	}
+	return nil
+}
+
+// testUniqueCode comprueba que el codigo sea unico entre todos los productos, borrados incluidos, que el error
+// indique que producto lo usa y que un producto pueda actualizarse manteniendo su propio codigo
+func testUniqueCode(ctx context.Context, s store.Store) error {
+	first, err := s.AddOne(ctx, sample(1))
+	if err != nil {
+		return err
+	}
+	second, err := s.AddOne(ctx, sample(2))
+	if err != nil {
+		return err
+	}
+	_, err = s.AddOne(ctx, sample(1))
+	var duplicate *store.DuplicateCodeError
+	if !errors.As(err, &duplicate) || !errors.Is(err, store.ErrDuplicateCode) || duplicate.ConflictingId != first.Id {
+		return fmt.Errorf("adding a repeated code returned %v, want a DuplicateCodeError with product %s", err, first.Id)
+	}
+	if err = s.UpdateOne(ctx, domain.Product{Id: first.Id, Name: "same code", CodeValue: first.CodeValue}); err != nil {
+		return fmt.Errorf("updating a product keeping its own code returned %v", err)
+	}
+	err = s.UpdateOne(ctx, domain.Product{Id: second.Id, CodeValue: first.CodeValue})
+	if !errors.As(err, &duplicate) || duplicate.ConflictingId != first.Id {
+		return fmt.Errorf("taking the code of another product returned %v, want a DuplicateCodeError with product %s", err, first.Id)
+	}
+	if err = s.DeleteOne(ctx, first.Id); err != nil {
+		return err
+	}
+	if _, err = s.AddOne(ctx, sample(1)); !errors.Is(err, store.ErrDuplicateCode) {
+		return fmt.Errorf("reusing the code of a deleted product returned %v, want ErrDuplicateCode", err)
+	}
+	if _, err = s.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		return err
+	}
+	if _, err = s.AddOne(ctx, sample(1)); err != nil {
+		return fmt.Errorf("reusing the code of a purged product returned %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"time"
+
+	"clase19/internal/domain"
+	"clase19/pkg/idgen"
+)
+
+// observer lo implementan los generadores secuenciales, que deben saltear los ids numericos ya existentes
+type observer interface {
+	Observe(id domain.ID)
+}
+
+// defaultGenerator devuelve gen, o una secuencia en memoria si no se indico ninguno
+func defaultGenerator(gen IDGenerator) IDGenerator {
+	if gen == nil {
+		return idgen.NewSequence(0)
+	}
+	return gen
+}
+
+// observeIDs informa al generador los ids existentes para que no los repita
+func observeIDs(gen IDGenerator, products []domain.Product) {
+	o, ok := gen.(observer)
+	if !ok {
+		return
+	}
+	for _, p := range products {
+		o.Observe(p.Id)
+	}
+}
+
+// updateProduct controla la version esperada y devuelve el producto actualizado con la version siguiente
+func updateProduct(current domain.Product, updated domain.Product) (domain.Product, error) {
+	if updated.Version != 0 && updated.Version != current.Version {
+		return domain.Product{}, ErrVersionConflict
+	}
+	p := completeEmptyAttributes(current, updated)
+	p.Version = current.Version + 1
+	return p, nil
+}
+
+// seedVersions pone version 1 a los productos cargados de un archivo sin version, como products.json,
+// para que tengan un ETag valido igual que los creados con AddOne
+func seedVersions(products []domain.Product) {
+	for i := range products {
+		if products[i].Version == 0 {
+			products[i].Version = 1
+		}
+	}
+}
+
+// deletedNow devuelve la fecha de borrado, en UTC y sin fracciones de segundo para que se guarde igual en todos los stores
+func deletedNow() *time.Time {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &now
+}
+
+// purgeable indica si un producto borrado cumplio el periodo de retencion
+func purgeable(p domain.Product, before time.Time) bool {
+	return p.DeletedAt != nil && p.DeletedAt.Before(before)
+}
+
+// completeEmptyAttributes compara dos productos y se queda con los campos diferentes
+func completeEmptyAttributes(product domain.Product, updatedProduct domain.Product) domain.Product {
+	p := product
+	if updatedProduct.Name != "" {
+		p.Name = updatedProduct.Name
+	}
+	if updatedProduct.Quantity != 0 {
+		p.Quantity = updatedProduct.Quantity
+	}
+	if updatedProduct.CodeValue != "" {
+		p.CodeValue = updatedProduct.CodeValue
+	}
+	if updatedProduct.IsPublished {
+		p.IsPublished = updatedProduct.IsPublished
+	}
+	if !updatedProduct.Expiration.IsZero() {
+		p.Expiration = updatedProduct.Expiration
+	}
+	if updatedProduct.Price.Amount != 0 {
+		p.Price.Amount = updatedProduct.Price.Amount
+	}
+	if updatedProduct.Price.Currency != "" {
+		p.Price.Currency = updatedProduct.Price.Currency
+	}
+	if updatedProduct.CategoryId != "" {
+		p.CategoryId = updatedProduct.CategoryId
+	}
+	if updatedProduct.Variant != "" {
+		p.Variant = updatedProduct.Variant
+	}
+	return p
+}
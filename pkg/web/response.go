@@ -7,9 +7,10 @@ import (
 )
 
 type errorResponse struct {
-	Status  int    `json:"status"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Status  int         `json:"status"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 type response struct {
@@ -31,3 +32,13 @@ func Failure(ctx *gin.Context, status int, err error) {
 		Code:    http.StatusText(status),
 	})
 }
+
+// FailureWithData escribe una respuesta fallida con datos del error, como el recurso con el que hay conflicto
+func FailureWithData(ctx *gin.Context, status int, err error, data interface{}) {
+	ctx.JSON(status, errorResponse{
+		Message: err.Error(),
+		Status:  status,
+		Code:    http.StatusText(status),
+		Data:    data,
+	})
+}